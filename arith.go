@@ -0,0 +1,533 @@
+package nutcracker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Arith is an arithmetic expansion. Nodes are expanded as if within double
+	// quotes, and the result is evaluated as an integer expression.
+	Arith struct {
+		span
+		Nodes []Node
+	}
+
+	// arithEval evaluates an arithmetic expression while parsing it
+	arithEval struct {
+		env  Env
+		n    Syntax
+		toks []string
+		pos  int
+	}
+)
+
+func newArith(nodes []Node) *Arith {
+	return &Arith{
+		Nodes: nodes,
+	}
+}
+
+func (n Arith) Value(ctx context.Context, env Env) (string, error) {
+	s := strings.Builder{}
+	for _, i := range n.Nodes {
+		if k, ok := i.(*Text); ok {
+			// line continuations are removed from the text of the expression
+			s.WriteString(strings.ReplaceAll(k.Text, "\\\n", ""))
+			continue
+		}
+		v, err := i.Value(ctx, env)
+		if err != nil {
+			return "", err
+		}
+		s.WriteString(v)
+	}
+	expr := s.String()
+	v, err := evalArith(env, n, expr)
+	if err != nil {
+		var uerr *UnsetVariableError
+		if errors.As(err, &uerr) {
+			return "", err
+		}
+		return "", &ArithError{
+			Pos:     n.Pos(),
+			Expr:    strings.TrimSpace(expr),
+			Message: err.Error(),
+		}
+	}
+	return strconv.FormatInt(v, 10), nil
+}
+
+// parseArith parses an arithmetic expansion, returning a nil node if the
+// text does not end with a matching '))', in which case it is a command
+// substitution
+// takes in a string beginning with '$(('
+func (p *parser) parseArith(text string) (Node, string, error) {
+	start := text
+	text = text[3:]
+	nodes := []Node{}
+	depth := 0
+	i := 0
+	for i < len(text) {
+		ch := text[i]
+		if ch == '$' || ch == '"' || ch == '`' || ch == ')' && depth == 0 {
+			if i > 0 {
+				n := newText(text[0:i])
+				n.setSpan(p.pos(text), p.pos(text[i:]))
+				nodes = append(nodes, n)
+				text = text[i:]
+				i = 0
+			}
+			var n Node
+			var next string
+			var err error
+			switch ch {
+			case '$':
+				n, next, err = p.parseVar(text)
+			case '"':
+				n, next, err = p.parseStrI(text)
+			case '`':
+				n, next, err = p.parseBacktick(text, false)
+			default:
+				if len(text) < 2 || text[1] != ')' {
+					return nil, "", nil
+				}
+				text = text[2:]
+				k := newArith(nodes)
+				k.setSpan(p.pos(start), p.pos(text))
+				return k, text, nil
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, n)
+			text = next
+		} else {
+			if ch == '(' {
+				depth++
+			} else if ch == ')' {
+				depth--
+			}
+			i++
+		}
+	}
+	return nil, "", nil
+}
+
+// evalArith evaluates the arithmetic expression expr of the node n
+func evalArith(env Env, n Syntax, expr string) (int64, error) {
+	toks, err := tokenizeArith(expr)
+	if err != nil {
+		return 0, err
+	}
+	if len(toks) == 0 {
+		return 0, nil
+	}
+	e := &arithEval{
+		env:  env,
+		n:    n,
+		toks: toks,
+	}
+	v, err := e.comma(false)
+	if err != nil {
+		return 0, err
+	}
+	if e.pos < len(e.toks) {
+		return 0, errors.New("syntax error near " + e.toks[e.pos])
+	}
+	return v, nil
+}
+
+var (
+	// arithOps are ordered such that longer operators are matched first
+	arithOps = []string{
+		"<<=", ">>=",
+		"++", "--", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+		"+=", "-=", "*=", "/=", "%=", "&=", "^=", "|=",
+		"+", "-", "*", "/", "%", "<", ">", "!", "~", "&", "^", "|", "?", ":", "=", "(", ")", ",",
+	}
+
+	arithPrec = map[string]int{
+		"||": 1,
+		"&&": 2,
+		"|":  3,
+		"^":  4,
+		"&":  5,
+		"==": 6, "!=": 6,
+		"<": 7, "<=": 7, ">": 7, ">=": 7,
+		"<<": 8, ">>": 8,
+		"+": 9, "-": 9,
+		"*": 10, "/": 10, "%": 10,
+	}
+
+	arithAssignOps = map[string]struct{}{
+		"=": {}, "*=": {}, "/=": {}, "%=": {}, "+=": {}, "-=": {},
+		"<<=": {}, ">>=": {}, "&=": {}, "^=": {}, "|=": {},
+	}
+)
+
+// tokenizeArith splits an arithmetic expression into numbers, names, and
+// operators
+func tokenizeArith(expr string) ([]string, error) {
+	toks := []string{}
+	for {
+		expr = strings.TrimLeft(expr, spaceCharSet)
+		if len(expr) == 0 {
+			return toks, nil
+		}
+		if k := parseTopEnvVar(expr); k > 0 {
+			toks = append(toks, expr[0:k])
+			expr = expr[k:]
+			continue
+		}
+		if isDigit(expr[0]) {
+			k := 1
+			for k < len(expr) && (isDigit(expr[k]) || parseTopEnvVar(expr[k:k+1]) > 0) {
+				k++
+			}
+			toks = append(toks, expr[0:k])
+			expr = expr[k:]
+			continue
+		}
+		op := ""
+		for _, i := range arithOps {
+			if strings.HasPrefix(expr, i) {
+				op = i
+				break
+			}
+		}
+		if len(op) == 0 {
+			return nil, errors.New("invalid character " + strconv.Quote(expr[0:1]))
+		}
+		toks = append(toks, op)
+		expr = expr[len(op):]
+	}
+}
+
+func (e *arithEval) peek() string {
+	if e.pos < len(e.toks) {
+		return e.toks[e.pos]
+	}
+	return ""
+}
+
+func (e *arithEval) peekName() (string, bool) {
+	k := e.peek()
+	return k, len(k) > 0 && parseTopEnvVar(k) == len(k)
+}
+
+func (e *arithEval) expect(tok string) error {
+	if e.peek() != tok {
+		if e.pos < len(e.toks) {
+			return errors.New("expected " + tok + " near " + e.toks[e.pos])
+		}
+		return errors.New("expected " + tok)
+	}
+	e.pos++
+	return nil
+}
+
+// lookup returns the integer value of a variable, where an unset or empty
+// variable is 0. The variable is not looked up if skip is set for an
+// unevaluated operand.
+func (e *arithEval) lookup(name string, skip bool) (int64, error) {
+	if skip {
+		return 0, nil
+	}
+	v, err := e.env.lookupRef(e.n, name)
+	if err != nil {
+		return 0, err
+	}
+	v = strings.TrimSpace(v)
+	if len(v) == 0 {
+		return 0, nil
+	}
+	num := v
+	if num[0] == '-' || num[0] == '+' {
+		num = num[1:]
+	}
+	k, err := parseArithNum(num)
+	if err != nil {
+		return 0, errors.New(name + ": invalid number " + strconv.Quote(v))
+	}
+	if v[0] == '-' {
+		k = -k
+	}
+	return k, nil
+}
+
+var (
+	arithDigits = map[int]string{
+		8:  "01234567",
+		10: "0123456789",
+		16: "0123456789abcdefABCDEF",
+	}
+)
+
+// parseArithNum parses an integer constant, which is hexadecimal with a
+// leading 0x or 0X, octal with a leading 0, and otherwise decimal
+func parseArithNum(s string) (int64, error) {
+	base := 10
+	digits := s
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		base = 16
+		digits = s[2:]
+	} else if len(s) > 1 && s[0] == '0' {
+		base = 8
+		digits = s[1:]
+	}
+	if len(digits) == 0 || strings.Trim(digits, arithDigits[base]) != "" {
+		return 0, errors.New("invalid number " + s)
+	}
+	return strconv.ParseInt(digits, base, 64)
+}
+
+// set assigns a variable unless skip is set for an unevaluated operand
+func (e *arithEval) set(name string, v int64, skip bool) {
+	if !skip && e.env.Vars != nil {
+		e.env.Vars[name] = strconv.FormatInt(v, 10)
+	}
+}
+
+// comma evaluates expressions separated by ',' to the value of the last. If
+// skip is set, the expression is parsed without side effects.
+func (e *arithEval) comma(skip bool) (int64, error) {
+	v, err := e.assign(skip)
+	if err != nil {
+		return 0, err
+	}
+	for e.peek() == "," {
+		e.pos++
+		v, err = e.assign(skip)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return v, nil
+}
+
+func (e *arithEval) assign(skip bool) (int64, error) {
+	name, ok := e.peekName()
+	if !ok || e.pos+1 >= len(e.toks) {
+		return e.ternary(skip)
+	}
+	op := e.toks[e.pos+1]
+	if _, ok := arithAssignOps[op]; !ok {
+		return e.ternary(skip)
+	}
+	e.pos += 2
+	v, err := e.assign(skip)
+	if err != nil {
+		return 0, err
+	}
+	if op != "=" {
+		k, err := e.lookup(name, skip)
+		if err != nil {
+			return 0, err
+		}
+		if v, err = applyArith(op[:len(op)-1], k, v, skip); err != nil {
+			return 0, err
+		}
+	}
+	e.set(name, v, skip)
+	return v, nil
+}
+
+func (e *arithEval) ternary(skip bool) (int64, error) {
+	c, err := e.binary(1, skip)
+	if err != nil {
+		return 0, err
+	}
+	if e.peek() != "?" {
+		return c, nil
+	}
+	e.pos++
+	a, err := e.comma(skip || c == 0)
+	if err != nil {
+		return 0, err
+	}
+	if err := e.expect(":"); err != nil {
+		return 0, err
+	}
+	b, err := e.ternary(skip || c != 0)
+	if err != nil {
+		return 0, err
+	}
+	if c != 0 {
+		return a, nil
+	}
+	return b, nil
+}
+
+// binary evaluates binary operators of at least the precedence prec
+func (e *arithEval) binary(prec int, skip bool) (int64, error) {
+	v, err := e.unary(skip)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := e.peek()
+		k, ok := arithPrec[op]
+		if !ok || k < prec {
+			return v, nil
+		}
+		e.pos++
+		switch op {
+		case "&&":
+			r, err := e.binary(k+1, skip || v == 0)
+			if err != nil {
+				return 0, err
+			}
+			v = arithBool(v != 0 && r != 0)
+		case "||":
+			r, err := e.binary(k+1, skip || v != 0)
+			if err != nil {
+				return 0, err
+			}
+			v = arithBool(v != 0 || r != 0)
+		default:
+			r, err := e.binary(k+1, skip)
+			if err != nil {
+				return 0, err
+			}
+			if v, err = applyArith(op, v, r, skip); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+func (e *arithEval) unary(skip bool) (int64, error) {
+	switch op := e.peek(); op {
+	case "+", "-", "!", "~":
+		e.pos++
+		v, err := e.unary(skip)
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "-":
+			return -v, nil
+		case "!":
+			return arithBool(v == 0), nil
+		case "~":
+			return ^v, nil
+		}
+		return v, nil
+	case "++", "--":
+		e.pos++
+		name, ok := e.peekName()
+		if !ok {
+			return 0, errors.New(op + " requires a variable")
+		}
+		e.pos++
+		v, err := e.lookup(name, skip)
+		if err != nil {
+			return 0, err
+		}
+		v += arithIncr(op)
+		e.set(name, v, skip)
+		return v, nil
+	}
+	return e.primary(skip)
+}
+
+func (e *arithEval) primary(skip bool) (int64, error) {
+	tok := e.peek()
+	if len(tok) == 0 {
+		return 0, errors.New("operand expected")
+	}
+	e.pos++
+	if tok == "(" {
+		v, err := e.comma(skip)
+		if err != nil {
+			return 0, err
+		}
+		if err := e.expect(")"); err != nil {
+			return 0, err
+		}
+		return v, nil
+	}
+	if isDigit(tok[0]) {
+		v, err := parseArithNum(tok)
+		if err != nil {
+			return 0, errors.New("invalid number " + tok)
+		}
+		return v, nil
+	}
+	if parseTopEnvVar(tok) != len(tok) {
+		return 0, errors.New("syntax error near " + tok)
+	}
+	v, err := e.lookup(tok, skip)
+	if err != nil {
+		return 0, err
+	}
+	if op := e.peek(); op == "++" || op == "--" {
+		e.pos++
+		e.set(tok, v+arithIncr(op), skip)
+	}
+	return v, nil
+}
+
+func arithIncr(op string) int64 {
+	if op == "++" {
+		return 1
+	}
+	return -1
+}
+
+func arithBool(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// applyArith applies a binary operator. Division by zero is not an error if
+// skip is set for an unevaluated operand.
+func applyArith(op string, a, b int64, skip bool) (int64, error) {
+	switch op {
+	case "*":
+		return a * b, nil
+	case "/", "%":
+		if b == 0 {
+			if skip {
+				return 0, nil
+			}
+			return 0, errors.New("division by zero")
+		}
+		if op == "/" {
+			return a / b, nil
+		}
+		return a % b, nil
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "<<":
+		return a << (uint64(b) & 63), nil
+	case ">>":
+		return a >> (uint64(b) & 63), nil
+	case "<":
+		return arithBool(a < b), nil
+	case "<=":
+		return arithBool(a <= b), nil
+	case ">":
+		return arithBool(a > b), nil
+	case ">=":
+		return arithBool(a >= b), nil
+	case "==":
+		return arithBool(a == b), nil
+	case "!=":
+		return arithBool(a != b), nil
+	case "&":
+		return a & b, nil
+	case "^":
+		return a ^ b, nil
+	case "|":
+		return a | b, nil
+	}
+	return 0, errors.New("invalid operator " + op)
+}
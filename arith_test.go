@@ -0,0 +1,161 @@
+package nutcracker
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_parseArith(t *testing.T) {
+	assert := assert.New(t)
+
+	{
+		arg := `$(( (a + $b) * "${c}" ))x`
+		n, next, err := newParser(arg).parseVar(arg)
+		assert.NoError(err, "parse var should not error")
+		assert.Equal("x", next, "only the arithmetic expansion should be parsed")
+		assert.Equal(newArith([]Node{newText(" (a + "), newEnvVar("b", nil), newText(") * "), newStrI([]Node{newEnvVar("c", nil)}), newText(" ")}), stripSpan(n), "arithmetic expansion should be parsed")
+	}
+	{
+		arg := `$(($(echo 1)+2))`
+		n, _, err := newParser(arg).parseVar(arg)
+		assert.NoError(err, "parse var should not error")
+		k, ok := n.(*Arith)
+		assert.True(ok, "arithmetic expansion should be parsed")
+		assert.Len(k.Nodes, 2, "command substitution should be parsed within arithmetic expansion")
+	}
+	{
+		arg := `$((1 + 2`
+		_, _, err := newParser(arg).parseVar(arg)
+		assert.True(errors.Is(err, ErrUnclosedParen), "unclosed arithmetic expansion should error")
+	}
+}
+
+func Test_evalArith(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, i := range []struct {
+		expr  string
+		value int64
+	}{
+		{expr: ``, value: 0},
+		{expr: `1 + 2 * 3`, value: 7},
+		{expr: `(1 + 2) * 3`, value: 9},
+		{expr: `7 / 2 + 7 % 2 - -1`, value: 5},
+		{expr: `-7 / 2`, value: -3},
+		{expr: `0x1f + 010 + 9`, value: 48},
+		{expr: `0XfF + 00 + neg + hex`, value: 255},
+		{expr: `1 << 4 | 1 >> 1 ^ 3 & 6`, value: 18},
+		{expr: `~0 + !0 + !5`, value: 0},
+		{expr: `2 < 3 && 3 <= 3 && 4 > 3 && 3 >= 4 || 5 == 5 && 5 != 6`, value: 1},
+		{expr: `0 || 0`, value: 0},
+		{expr: `1 ? 2 : 3`, value: 2},
+		{expr: `0 ? 2 : 0 ? 3 : 4`, value: 4},
+		{expr: `port + shard * 10`, value: 8030},
+		{expr: `unset + empty + 1`, value: 1},
+		{expr: `1, 2, 3`, value: 3},
+	} {
+		env := Env{Vars: map[string]string{"port": "8000", "shard": " 3 ", "empty": "", "neg": "-0x10", "hex": "+0x10"}}
+		v, err := evalArith(env, newArith(nil), i.expr)
+		assert.NoError(err, "expression %q should not error", i.expr)
+		assert.Equal(i.value, v, "expression %q should be evaluated", i.expr)
+	}
+	{
+		vars := map[string]string{"a": "5"}
+		env := Env{Vars: vars}
+		for _, i := range []struct {
+			expr  string
+			value int64
+		}{
+			{expr: `b = a + 1`, value: 6},
+			{expr: `a += 2`, value: 7},
+			{expr: `a -= b - 1`, value: 2},
+			{expr: `a *= 3`, value: 6},
+			{expr: `a /= 4`, value: 1},
+			{expr: `a <<= 3`, value: 8},
+			{expr: `a |= 3`, value: 11},
+			{expr: `a %= 4`, value: 3},
+			{expr: `c = d = 2`, value: 2},
+			{expr: `a++ + ++b`, value: 10},
+			{expr: `--a + b--`, value: 10},
+			{expr: `a == 3 && b == 6`, value: 1},
+			{expr: `0 && (e = 1)`, value: 0},
+			{expr: `1 || (e = 1)`, value: 1},
+			{expr: `1 ? f = 1 : (e = 1)`, value: 1},
+			{expr: `0 && 1 / 0`, value: 0},
+		} {
+			v, err := evalArith(env, newArith(nil), i.expr)
+			assert.NoError(err, "expression %q should not error", i.expr)
+			assert.Equal(i.value, v, "expression %q should be evaluated", i.expr)
+		}
+		assert.Equal(map[string]string{"a": "3", "b": "6", "c": "2", "d": "2", "f": "1"}, vars, "assignments should set variables only if evaluated")
+	}
+	for _, i := range []string{`1 / 0`, `1 % 0`, `1 +`, `(1`, `1 2`, `1 ? 2`, `a = `, `09`, `bad`, `1 @ 2`, `++1`, `1_000`, `0b101`, `0o7`, `0x`, `1e3`, `bin`, `sep`} {
+		_, err := evalArith(Env{Vars: map[string]string{"bad": "x1", "bin": "0b1", "sep": "1_0"}}, newArith(nil), i)
+		assert.Error(err, "expression %q should error", i)
+	}
+}
+
+func Test_Arith_Value(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	{
+		vars := map[string]string{"base": "8000", "i": "2"}
+		n, err := Parse(`echo $((base + i)) $(( i += 1 ))$((i))`)
+		assert.NoError(err, "Parse should not error")
+		args := n.Lists[0].Pipes[0].Cmds[0].Args
+		fields := []string{}
+		for _, i := range args {
+			v, err := i.Fields(ctx, Env{Vars: vars})
+			assert.NoError(err, "fields should not error")
+			fields = append(fields, v...)
+		}
+		assert.Equal([]string{"echo", "8002", "33"}, fields, "arithmetic expansions should be evaluated in order")
+		assert.Equal("3", vars["i"], "arithmetic assignment should set variables")
+	}
+	{
+		arg := `$(( $n * 2 + ${#s} ))`
+		n, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		v, err := n.Value(ctx, Env{Vars: map[string]string{"n": "1 + 2", "s": "abc"}})
+		assert.NoError(err, "value should not error")
+		assert.Equal("8", v, "expansions should be substituted as text before the expression is evaluated")
+	}
+	{
+		arg := `x $((1 / (2 - 2)))`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Builtins: DefaultBuiltins()})
+		var aerr *ArithError
+		assert.True(errors.As(err, &aerr), "division by zero should return an arith error")
+		assert.Equal(&ArithError{Pos: Pos{Offset: 2, Line: 1, Col: 3}, Expr: "1 / (2 - 2)", Message: "division by zero"}, aerr, "arith error should contain the position and expression")
+	}
+	{
+		arg := `$((x + 1))`
+		n, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		_, err = n.Value(ctx, Env{Nounset: true})
+		var uerr *UnsetVariableError
+		assert.True(errors.As(err, &uerr), "unset variables should error with nounset")
+		assert.Equal("x", uerr.Name, "unset variable error should contain the name")
+	}
+	for _, i := range []struct {
+		arg   string
+		value string
+	}{
+		{arg: "$((0 && y))", value: "0"},
+		{arg: "$((1 || y))", value: "1"},
+		{arg: "$((0 ? y : 1))", value: "1"},
+		{arg: "$((0 && (y += 1, ++y, y--)))", value: "0"},
+		{arg: "$((1 +\\\n  2))", value: "3"},
+		{arg: "$((3\\\n4))", value: "34"},
+	} {
+		n, _, err := newParser(i.arg).parseArg(i.arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		v, err := n.Value(ctx, Env{Vars: map[string]string{}, Nounset: true})
+		assert.NoError(err, "value of %q should not error", i.arg)
+		assert.Equal(i.value, v, "value of %q should be evaluated", i.arg)
+	}
+}
@@ -0,0 +1,86 @@
+package nutcracker
+
+import (
+	"context"
+	"os"
+	"regexp"
+)
+
+type (
+	// Assign is a variable assignment word of a command. Assignments of a
+	// command without args are set in Env.Vars, and otherwise are added to
+	// the environment of the command.
+	Assign struct {
+		span
+		Name  string
+		Value *Arg
+	}
+)
+
+func newAssign(name string, value *Arg) *Assign {
+	return &Assign{
+		Name:  name,
+		Value: value,
+	}
+}
+
+// assignValues evaluates assignments in order, returning NAME=value entries
+func assignValues(ctx context.Context, env Env, assigns []*Assign) ([]string, error) {
+	k := make([]string, 0, len(assigns))
+	for _, i := range assigns {
+		v, err := i.Value.Value(ctx, env)
+		if err != nil {
+			return nil, err
+		}
+		k = append(k, i.Name+"="+v)
+	}
+	return k, nil
+}
+
+// setVars sets the evaluated assignments in env.Vars if it is non-nil
+func setVars(env Env, assigns []*Assign, values []string) {
+	if env.Vars == nil {
+		return
+	}
+	for n, i := range assigns {
+		env.Vars[i.Name] = values[n][len(i.Name)+1:]
+	}
+}
+
+// withEnvvar returns env with entries added to the environment of commands,
+// which is inherited from the current process if env.Envvar is nil
+func withEnvvar(env Env, entries []string) Env {
+	base := env.Envvar
+	if base == nil {
+		base = os.Environ()
+	}
+	k := make([]string, 0, len(base)+len(entries))
+	k = append(k, base...)
+	k = append(k, entries...)
+	env.Envvar = k
+	return env
+}
+
+var (
+	regexFindAssign = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*=`)
+)
+
+// parseAssign parses an assignment if one exists at the beginning of the
+// text. The returned assignment is nil if the text does not begin with a
+// variable name followed by '='.
+// takes in a string not beginning with whitespace
+func (p *parser) parseAssign(text string, mode int) (*Assign, string, error) {
+	k := len(regexFindAssign.FindString(text))
+	if k == 0 {
+		return nil, text, nil
+	}
+	start := text
+	name := text[0 : k-1]
+	value, next, err := p.parseWord(text[k:], mode, true)
+	if err != nil {
+		return nil, "", err
+	}
+	a := newAssign(name, value)
+	a.setSpan(p.pos(start), value.End())
+	return a, next, nil
+}
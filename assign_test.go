@@ -0,0 +1,127 @@
+package nutcracker
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func Test_parseAssign(t *testing.T) {
+	assert := assert.New(t)
+
+	{
+		arg := `FOO=bar cmd`
+		a, next, err := newParser(arg).parseAssign(arg, argModeNorm)
+		assert.NoError(err, "parse Assign should not error")
+		assert.Equal("cmd", next, "only the Assign should be parsed")
+		assert.Equal(newAssign("FOO", newArg([]Node{newText("bar")})), stripSpan(a), "Assign should be parsed")
+	}
+	{
+		arg := `_a1="b $c"=d`
+		a, next, err := newParser(arg).parseAssign(arg, argModeNorm)
+		assert.NoError(err, "parse Assign should not error")
+		assert.Equal("", next, "only the Assign should be parsed")
+		assert.Equal(newAssign("_a1", newArg([]Node{newStrI([]Node{newText("b "), newEnvVar("c", nil)}), newText("=d")})), stripSpan(a), "Assign value should be an arg")
+	}
+	{
+		arg := `FOO= cmd`
+		a, next, err := newParser(arg).parseAssign(arg, argModeNorm)
+		assert.NoError(err, "parse Assign should not error")
+		assert.Equal("cmd", next, "only the Assign should be parsed")
+		assert.Equal(newAssign("FOO", newArg([]Node{})), stripSpan(a), "empty Assign should be parsed")
+	}
+	{
+		for _, i := range []string{`cmd`, `1A=b`, `=b`, `"A"=b`, `A\=b`, `A+=b`} {
+			a, next, err := newParser(i).parseAssign(i, argModeNorm)
+			assert.NoError(err, "parse Assign should not error")
+			assert.Nil(a, "text not beginning with an Assign should not be parsed")
+			assert.Equal(i, next, "text not beginning with an Assign should not be consumed")
+		}
+	}
+}
+
+func Test_Assign(t *testing.T) {
+	assert := assert.New(t)
+
+	exec := NewExecutor()
+	{
+		n, err := Parse(`A=1 B=2 >out cmd C=3`)
+		assert.NoError(err, "Parse should not error")
+		cmd := n.Lists[0].Pipes[0].Cmds[0]
+		assert.Equal([]*Assign{
+			newAssign("A", newArg([]Node{newText("1")})),
+			newAssign("B", newArg([]Node{newText("2")})),
+		}, stripSpan(cmd.Assigns), "assignments should be parsed before args")
+		assert.Equal([]*Arg{newArg([]Node{newText("cmd")}), newArg([]Node{newText("C=3")})}, stripSpan(cmd.Args), "assignments after args should be args")
+	}
+	{
+		b := bytes.Buffer{}
+		vars := map[string]string{}
+		n, err := Parse("FOO=bar\necho $FOO; FOO=baz BAR=$FOO sh -c 'echo $FOO $BAR'; echo $FOO")
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Vars: vars, Ex: exec, Stdout: &b})
+		assert.NoError(err, "script should not error")
+		assert.Equal("bar\nbaz bar\nbar\n", b.String(), "prefix assignments should only apply to the command environment")
+		assert.Equal(map[string]string{"FOO": "bar"}, vars, "standalone assignments should be set in vars")
+	}
+	{
+		b := bytes.Buffer{}
+		n, err := Parse(`x=1; echo $x $((y = x + 1)) ${z:=3}; echo $y $z`)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Envvar: []string{}, Ex: exec, Stdout: &b})
+		assert.NoError(err, "script should not error")
+		assert.Equal("1 2 3\n2 3\n", b.String(), "assignments should be set for the script without vars")
+	}
+	{
+		b := bytes.Buffer{}
+		n, err := Parse(`FOO=bar sh -c 'echo $FOO $PATH'`)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Ex: exec, Stdout: &b})
+		assert.NoError(err, "script should not error")
+		assert.Equal("bar "+os.Getenv("PATH")+"\n", b.String(), "prefix assignments should inherit the process environment")
+	}
+	{
+		b := bytes.Buffer{}
+		n, err := Parse(`GOOS=linux sh -c 'echo $GOOS $HOME'`)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Envvar: []string{"HOME=/home", "GOOS=darwin"}, Ex: exec, Stdout: &b})
+		assert.NoError(err, "script should not error")
+		assert.Equal("linux /home\n", b.String(), "prefix assignments should override envvar")
+	}
+	{
+		b := bytes.Buffer{}
+		vars := map[string]string{}
+		n, err := Parse(`A=1 | cat; echo $(B=2) $A $B`)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Vars: vars, Ex: exec, Stdout: &b})
+		assert.NoError(err, "script should not error")
+		assert.Equal("\n", b.String(), "assignments in pipelines and command substitutions should not persist")
+		assert.Equal(map[string]string{}, vars, "assignments in subshells should not be set in vars")
+	}
+	{
+		for _, i := range []struct {
+			arg string
+			out string
+		}{
+			{`A=1 B= C='' D="$e f" cmd x=y`, `A=1 B= C='' D="$e f" cmd x=y`},
+			{`A=1 >out`, `A=1 >out`},
+		} {
+			n, err := Parse(i.arg)
+			assert.NoError(err, "Parse should not error")
+			out := Print(n)
+			assert.Equal(i.out, out, "Print should output assignments")
+			k, err := Parse(out)
+			assert.NoError(err, "printed source should parse")
+			assert.Equal(stripSpan(n), stripSpan(k), "printed source should parse to the same syntax tree")
+		}
+	}
+	{
+		n := newCmd([]*Arg{newArg([]Node{newText("A=b"), newEnvVar("c", nil)})}, []*Redirect{})
+		out := Print(n)
+		assert.Equal(`A\=b$c`, out, "Print should escape args which would be parsed as assignments")
+		k, err := Parse(out)
+		assert.NoError(err, "printed source should parse")
+		assert.Equal(0, len(k.Lists[0].Pipes[0].Cmds[0].Assigns), "escaped args should not be parsed as assignments")
+	}
+}
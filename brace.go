@@ -0,0 +1,335 @@
+package nutcracker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Brace is a brace expansion which expands to a field for each of the
+	// alternative Words
+	Brace struct {
+		span
+		Words []*Arg
+	}
+
+	// BraceSeq is a brace expansion which expands to a field for each integer
+	// or letter from From to To, incrementing by Step
+	BraceSeq struct {
+		span
+		From string
+		To   string
+		Step int
+	}
+)
+
+func newBrace(words []*Arg) *Brace {
+	return &Brace{
+		Words: words,
+	}
+}
+
+func newBraceSeq(from, to string, step int) *BraceSeq {
+	return &BraceSeq{
+		From: from,
+		To:   to,
+		Step: step,
+	}
+}
+
+// Value evaluates the braces as literal text
+func (n Brace) Value(ctx context.Context, env Env) (string, error) {
+	s := strings.Builder{}
+	s.WriteByte('{')
+	for n, i := range n.Words {
+		if n > 0 {
+			s.WriteByte(',')
+		}
+		v, err := i.Value(ctx, env)
+		if err != nil {
+			return "", err
+		}
+		s.WriteString(v)
+	}
+	s.WriteByte('}')
+	return s.String(), nil
+}
+
+// Value evaluates the braces as literal text
+func (n BraceSeq) Value(ctx context.Context, env Env) (string, error) {
+	return n.text(), nil
+}
+
+// text returns the source text of the sequence
+func (n BraceSeq) text() string {
+	s := "{" + n.From + ".." + n.To
+	if n.Step != 0 {
+		s += ".." + strconv.Itoa(n.Step)
+	}
+	return s + "}"
+}
+
+// values returns the elements of the sequence. Integers are padded with
+// zeros to the same width if either bound has a leading zero.
+func (n BraceSeq) values() []string {
+	start, end, step := n.bounds()
+	if !isDigit(n.From[len(n.From)-1]) {
+		k := []string{}
+		for _, i := range seqRange(start, end, step) {
+			k = append(k, string(rune(i)))
+		}
+		return k
+	}
+	width := 0
+	if hasLeadingZero(n.From) || hasLeadingZero(n.To) {
+		width = len(n.From)
+		if len(n.To) > width {
+			width = len(n.To)
+		}
+	}
+	k := []string{}
+	for _, i := range seqRange(start, end, step) {
+		k = append(k, fmt.Sprintf("%0*d", width, i))
+	}
+	return k
+}
+
+// len returns the number of elements of the sequence
+func (n BraceSeq) len() uint64 {
+	return seqLen(n.bounds())
+}
+
+// bounds returns the integer bounds of the sequence and the magnitude of its
+// step
+func (n BraceSeq) bounds() (int, int, uint64) {
+	step := uint64(n.Step)
+	if n.Step < 0 {
+		step = -step
+	} else if n.Step == 0 {
+		step = 1
+	}
+	if !isDigit(n.From[len(n.From)-1]) {
+		return int(n.From[0]), int(n.To[0]), step
+	}
+	start, _ := strconv.Atoi(n.From)
+	end, _ := strconv.Atoi(n.To)
+	return start, end, step
+}
+
+// seqLen returns the number of integers from start to end inclusive,
+// incrementing or decrementing by step toward end
+func seqLen(start, end int, step uint64) uint64 {
+	// the distance between the bounds is computed without overflow in
+	// unsigned arithmetic
+	d := uint64(end) - uint64(start)
+	if start > end {
+		d = uint64(start) - uint64(end)
+	}
+	k := d / step
+	if k == math.MaxUint64 {
+		return k
+	}
+	return k + 1
+}
+
+// seqRange returns the integers from start to end inclusive, incrementing or
+// decrementing by step toward end
+func seqRange(start, end int, step uint64) []int {
+	l := seqLen(start, end, step)
+	k := make([]int, 0, l)
+	for i := uint64(0); i < l; i++ {
+		if start <= end {
+			k = append(k, int(uint64(start)+i*step))
+		} else {
+			k = append(k, int(uint64(start)-i*step))
+		}
+	}
+	return k
+}
+
+func hasLeadingZero(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	return len(s) > 1 && s[0] == '0'
+}
+
+// braceNodes returns the node lists of the fields that nodes expand to if
+// env.BraceExpand is set, and otherwise nodes with braces as literal text.
+// Braces are also literal text if they would expand to more than
+// maxBraceWords fields.
+func (env Env) braceNodes(nodes []Node) [][]Node {
+	if !env.BraceExpand || braceCount(nodes) > maxBraceWords {
+		return [][]Node{flattenBraces(nodes)}
+	}
+	return expandBraces(nodes)
+}
+
+// braceCount returns the number of node lists that nodes expand to, or
+// maxBraceWords+1 if the number is greater than maxBraceWords
+func braceCount(nodes []Node) uint64 {
+	k := uint64(1)
+	for _, i := range nodes {
+		c := uint64(0)
+		switch b := i.(type) {
+		case *Brace:
+			for _, j := range b.Words {
+				c += braceCount(j.Nodes)
+			}
+		case *BraceSeq:
+			c = b.len()
+		default:
+			continue
+		}
+		if c > maxBraceWords {
+			return maxBraceWords + 1
+		}
+		k *= c
+		if k > maxBraceWords {
+			return maxBraceWords + 1
+		}
+	}
+	return k
+}
+
+// expandBraces returns the node lists resulting from the expansion of each
+// brace expansion in nodes, from left to right
+func expandBraces(nodes []Node) [][]Node {
+	for n, i := range nodes {
+		var alts [][]Node
+		switch k := i.(type) {
+		case *Brace:
+			for _, j := range k.Words {
+				alts = append(alts, expandBraces(j.Nodes)...)
+			}
+		case *BraceSeq:
+			for _, j := range k.values() {
+				alts = append(alts, []Node{newText(j)})
+			}
+		default:
+			continue
+		}
+		rest := expandBraces(nodes[n+1:])
+		words := make([][]Node, 0, len(alts)*len(rest))
+		for _, j := range alts {
+			for _, r := range rest {
+				w := make([]Node, 0, n+len(j)+len(r))
+				w = append(w, nodes[0:n]...)
+				w = append(w, j...)
+				w = append(w, r...)
+				words = append(words, w)
+			}
+		}
+		return words
+	}
+	return [][]Node{nodes}
+}
+
+// flattenBraces returns nodes with each brace expansion replaced by its
+// literal text
+func flattenBraces(nodes []Node) []Node {
+	k := make([]Node, 0, len(nodes))
+	for _, i := range nodes {
+		switch b := i.(type) {
+		case *Brace:
+			k = append(k, newText("{"))
+			for n, j := range b.Words {
+				if n > 0 {
+					k = append(k, newText(","))
+				}
+				k = append(k, flattenBraces(j.Nodes)...)
+			}
+			k = append(k, newText("}"))
+		case *BraceSeq:
+			k = append(k, newText(b.text()))
+		default:
+			k = append(k, i)
+		}
+	}
+	return k
+}
+
+const (
+	// maxBraceWords is the maximum number of elements of a brace sequence, and
+	// of fields of a word with brace expansions, beyond which the braces are
+	// literal text
+	maxBraceWords = 1 << 16
+)
+
+var (
+	regexBraceSeq = regexp.MustCompile(`^\{(?:(-?[0-9]+)\.\.(-?[0-9]+)|([a-zA-Z])\.\.([a-zA-Z]))(?:\.\.(-?[0-9]+))?\}`)
+)
+
+// parseBrace parses a brace expansion, returning a nil node if the braces do
+// not form a brace expansion, in which case they are literal text
+// takes in a string beginning with '{'
+func (p *parser) parseBrace(text string) (Node, string, error) {
+	offset := len(p.src) - len(text)
+	if _, ok := p.noBrace[offset]; ok {
+		return nil, "", nil
+	}
+	n, next, err := p.parseBraceExpansion(text)
+	if err == nil && n == nil {
+		p.noBrace[offset] = struct{}{}
+	}
+	return n, next, err
+}
+
+// parseBraceExpansion parses a brace sequence or the alternatives of a brace
+// expansion
+// takes in a string beginning with '{'
+func (p *parser) parseBraceExpansion(text string) (Node, string, error) {
+	if m := regexBraceSeq.FindStringSubmatch(text); m != nil {
+		start, end := m[1], m[2]
+		if len(start) == 0 {
+			start, end = m[3], m[4]
+		} else if _, err := strconv.Atoi(start); err != nil {
+			return nil, "", nil
+		} else if _, err := strconv.Atoi(end); err != nil {
+			return nil, "", nil
+		}
+		step := 0
+		if len(m[5]) > 0 {
+			var err error
+			if step, err = strconv.Atoi(m[5]); err != nil {
+				return nil, "", nil
+			}
+		}
+		next := text[len(m[0]):]
+		n := newBraceSeq(start, end, step)
+		if n.len() > maxBraceWords {
+			return nil, "", nil
+		}
+		n.setSpan(p.pos(text), p.pos(next))
+		return n, next, nil
+	}
+
+	words := []*Arg{}
+	next := text[1:]
+	for {
+		n, rest, err := p.parseArg(next, argModeBrace)
+		if err != nil {
+			return nil, "", err
+		}
+		words = append(words, n)
+		if len(rest) == 0 {
+			return nil, "", nil
+		}
+		switch rest[0] {
+		case ',':
+			next = rest[1:]
+		case '}':
+			// a brace expansion must have at least one unquoted comma
+			if len(words) < 2 {
+				return nil, "", nil
+			}
+			n := newBrace(words)
+			n.setSpan(p.pos(text), p.pos(rest[1:]))
+			return n, rest[1:], nil
+		default:
+			return nil, "", nil
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package nutcracker
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_parseBrace(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, i := range []struct {
+		arg  string
+		n    Node
+		next string
+	}{
+		{arg: `{a,b}c`, n: newBrace([]*Arg{newArg([]Node{newText("a")}), newArg([]Node{newText("b")})}), next: "c"},
+		{arg: `{,"b c"}`, n: newBrace([]*Arg{newArg([]Node{}), newArg([]Node{newStrI([]Node{newText("b c")})})})},
+		{arg: `{a,{b,c}}`, n: newBrace([]*Arg{newArg([]Node{newText("a")}), newArg([]Node{newBrace([]*Arg{newArg([]Node{newText("b")}), newArg([]Node{newText("c")})})})})},
+		{arg: `{$a,*.go}`, n: newBrace([]*Arg{newArg([]Node{newEnvVar("a", nil)}), newArg([]Node{newGlob("*.go")})})},
+		{arg: `{a\,b,c}`, n: newBrace([]*Arg{newArg([]Node{newText("a,b")}), newArg([]Node{newText("c")})})},
+		{arg: `{1..10}`, n: newBraceSeq("1", "10", 0)},
+		{arg: `{-3..03..2} x`, n: newBraceSeq("-3", "03", 2), next: " x"},
+		{arg: `{a..e..-1}`, n: newBraceSeq("a", "e", -1)},
+		{arg: `{a}`, n: nil},
+		{arg: `{}`, n: nil},
+		{arg: `{a, b}`, n: nil},
+		{arg: `{a,b`, n: nil},
+		{arg: `{1..b}`, n: nil},
+		{arg: `{ab..c}`, n: nil},
+		{arg: `{99999999999999999999..1}`, n: nil},
+		{arg: `{1..9223372036854775807}`, n: nil},
+		{arg: `{-9223372036854775808..9223372036854775807}`, n: nil},
+		{arg: `{1..65537}`, n: nil},
+		{arg: `{1..65536}`, n: newBraceSeq("1", "65536", 0)},
+	} {
+		n, next, err := newParser(i.arg).parseBrace(i.arg)
+		assert.NoError(err, "parse brace should not error for %q", i.arg)
+		if i.n == nil {
+			assert.Nil(n, "%q should not be a brace expansion", i.arg)
+			continue
+		}
+		assert.Equal(i.n, stripSpan(n), "brace expansion should be parsed for %q", i.arg)
+		assert.Equal(i.next, next, "only the braces should be parsed for %q", i.arg)
+	}
+	{
+		arg := `{a,"b}`
+		_, _, err := newParser(arg).parseBrace(arg)
+		assert.True(errors.Is(err, ErrUnclosedStrI), "parse brace should error on an unclosed string")
+	}
+	{
+		arg := `x{a}y{b,c}`
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		assert.Equal("", next, "the whole arg should be parsed")
+		assert.Equal(newArg([]Node{newText("x{a}y"), newBrace([]*Arg{newArg([]Node{newText("b")}), newArg([]Node{newText("c")})})}), stripSpan(n), "braces which are not an expansion should be text")
+	}
+	{
+		arg := strings.Repeat("{", 40) + strings.Repeat("{a,", 40)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		assert.Equal("", next, "the whole arg should be parsed")
+		assert.Equal(newArg([]Node{newText(arg)}), stripSpan(n), "unclosed braces should be parsed once as text")
+	}
+}
+
+func Test_BraceSeq_values(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, i := range []struct {
+		n      *BraceSeq
+		values []string
+	}{
+		{n: newBraceSeq("1", "5", 0), values: []string{"1", "2", "3", "4", "5"}},
+		{n: newBraceSeq("5", "1", 2), values: []string{"5", "3", "1"}},
+		{n: newBraceSeq("0", "10", -5), values: []string{"0", "5", "10"}},
+		{n: newBraceSeq("-2", "1", 0), values: []string{"-2", "-1", "0", "1"}},
+		{n: newBraceSeq("08", "11", 0), values: []string{"08", "09", "10", "11"}},
+		{n: newBraceSeq("-1", "001", 0), values: []string{"-01", "000", "001"}},
+		{n: newBraceSeq("a", "e", 2), values: []string{"a", "c", "e"}},
+		{n: newBraceSeq("C", "A", 0), values: []string{"C", "B", "A"}},
+		{n: newBraceSeq("3", "3", 0), values: []string{"3"}},
+		{n: newBraceSeq("1", "10", 9223372036854775807), values: []string{"1"}},
+		{n: newBraceSeq("9223372036854775806", "9223372036854775807", 2), values: []string{"9223372036854775806"}},
+		{n: newBraceSeq("-9223372036854775808", "9223372036854775807", -9223372036854775808), values: []string{"-9223372036854775808", "0"}},
+		{n: newBraceSeq("9223372036854775807", "-9223372036854775808", 9223372036854775807), values: []string{"9223372036854775807", "0", "-9223372036854775807"}},
+	} {
+		assert.Equal(i.values, i.n.values(), "sequence %s should be expanded", i.n.text())
+	}
+}
+
+func Test_Arg_Fields_Brace(t *testing.T) {
+	assert := assert.New(t)
+
+	env := Env{
+		BraceExpand: true,
+		Vars: map[string]string{
+			"a":   "x y",
+			"ext": "txt",
+		},
+	}
+	for _, i := range []struct {
+		arg    string
+		fields []string
+	}{
+		{arg: `file.{txt,bak}`, fields: []string{"file.txt", "file.bak"}},
+		{arg: `a{b,c{d,e}f}g`, fields: []string{"abg", "acdfg", "acefg"}},
+		{arg: `{a,b}{1..2}`, fields: []string{"a1", "a2", "b1", "b2"}},
+		{arg: `{x,y}{,.bak}`, fields: []string{"x", "x.bak", "y", "y.bak"}},
+		{arg: `f{01..3}`, fields: []string{"f01", "f02", "f03"}},
+		{arg: `{a..c}`, fields: []string{"a", "b", "c"}},
+		{arg: `{$a,"$a"}`, fields: []string{"x", "y", "x y"}},
+		{arg: `{,}`, fields: []string{}},
+		{arg: `""{,}`, fields: []string{"", ""}},
+		{arg: `.${ext}{,.gz}`, fields: []string{".txt", ".txt.gz"}},
+		{arg: `"{a,b}" '{a,b}' \{a,b\}`, fields: []string{"{a,b}"}},
+		{arg: `{a}`, fields: []string{"{a}"}},
+		{arg: `{1..65536}{1..65536}`, fields: []string{"{1..65536}{1..65536}"}},
+		{arg: `{a,{1..65536}}{1..2}`, fields: []string{"{a,{1..65536}}{1..2}"}},
+	} {
+		n, _, err := newParser(i.arg).parseArg(i.arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		fields, err := n.Fields(context.Background(), env)
+		assert.NoError(err, "fields should not error")
+		assert.Equal(i.fields, fields, "braces should be expanded for %q", i.arg)
+	}
+	{
+		arg := `{1..256}{1..256}`
+		n, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		fields, err := n.Fields(context.Background(), env)
+		assert.NoError(err, "fields should not error")
+		assert.Equal(65536, len(fields), "braces should be expanded up to the maximum number of fields")
+	}
+	for _, i := range []struct {
+		arg    string
+		fields []string
+	}{
+		{arg: `file.{txt,bak}`, fields: []string{"file.{txt,bak}"}},
+		{arg: `{$a,b}`, fields: []string{"{x", "y,b}"}},
+		{arg: `{1..3}`, fields: []string{"{1..3}"}},
+	} {
+		n, _, err := newParser(i.arg).parseArg(i.arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		fields, err := n.Fields(context.Background(), Env{Vars: env.Vars})
+		assert.NoError(err, "fields should not error")
+		assert.Equal(i.fields, fields, "braces should be text without BraceExpand for %q", i.arg)
+	}
+	{
+		args, err := globArgs(`y={a,b}; args {b,a}.go {c,d}.go x={a,b} $y`, Env{BraceExpand: true, FS: fstest.MapFS{"a.go": {}, "b.go": {}}})
+		assert.NoError(err, "script should not error")
+		assert.Equal([]string{"b.go", "a.go", "c.go", "d.go", "x=a", "x=b", "{a,b}"}, args, "braces should be expanded before globbing, and not in assignments or variables")
+	}
+	{
+		args, err := globArgs(`args *.{go,md}`, Env{BraceExpand: true, FS: fstest.MapFS{"a.go": {}, "b.md": {}, "c.txt": {}}})
+		assert.NoError(err, "script should not error")
+		assert.Equal([]string{"a.go", "b.md"}, args, "patterns should be expanded after braces")
+	}
+}
@@ -0,0 +1,376 @@
+package nutcracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+type (
+	// BuiltinFunc runs a builtin command in the process. args[0] is the name
+	// of the command, and stdio and shell state are provided by env. As with
+	// an Executor, an error is returned only if the command could not be run.
+	BuiltinFunc func(ctx context.Context, args []string, env Env) (Status, error)
+
+	// shellExit is returned by the exit builtin to stop the current script
+	// with a status
+	shellExit struct {
+		status Status
+	}
+)
+
+func (e *shellExit) Error() string {
+	return fmt.Sprintf("exit %d", e.status.Code)
+}
+
+// DefaultBuiltins returns a new registry of the builtins cd, export, unset,
+// exit, true, false, echo, test, and [. Builtins which modify shell state
+// return ErrNoShell if env.Shell is nil.
+func DefaultBuiltins() map[string]BuiltinFunc {
+	return map[string]BuiltinFunc{
+		"cd":     builtinCd,
+		"export": builtinExport,
+		"unset":  builtinUnset,
+		"exit":   builtinExit,
+		"true":   builtinTrue,
+		"false":  builtinFalse,
+		"echo":   builtinEcho,
+		"test":   builtinTest,
+		"[":      builtinTest,
+	}
+}
+
+// builtinFail writes an error message for a builtin to stderr and returns
+// the status code
+func builtinFail(env Env, args []string, code int, msg string) Status {
+	if env.Stderr != nil {
+		fmt.Fprintf(env.Stderr, "%s: %s\n", args[0], msg)
+	}
+	return Status{
+		Code: code,
+	}
+}
+
+// builtinWriteFail returns the status of a builtin which could not write its
+// output, which is 128 plus SIGPIPE if the reader has exited, as though the
+// builtin were terminated by the signal
+func builtinWriteFail(env Env, args []string, err error) Status {
+	if errors.Is(err, syscall.EPIPE) {
+		return Status{
+			Code: 128 + int(syscall.SIGPIPE),
+		}
+	}
+	return builtinFail(env, args, 1, "write error: "+err.Error())
+}
+
+// resolvePath returns the path p relative to the working directory of env
+func resolvePath(env Env, p string) string {
+	if env.Shell != nil {
+		env.Dir = env.Shell.Dir
+	}
+	if len(env.Dir) == 0 || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(env.Dir, p)
+}
+
+// builtinCd changes the working directory of the shell to the arg, $HOME if
+// omitted, or $OLDPWD if the arg is '-', and sets $PWD and $OLDPWD
+func builtinCd(ctx context.Context, args []string, env Env) (Status, error) {
+	if env.Shell == nil {
+		return Status{}, ErrNoShell
+	}
+	if len(args) > 2 {
+		return builtinFail(env, args, 1, "too many arguments"), nil
+	}
+	var dir string
+	printDir := false
+	if len(args) == 2 && args[1] == "-" {
+		v, ok := env.LookupVar("OLDPWD")
+		if !ok {
+			return builtinFail(env, args, 1, "OLDPWD not set"), nil
+		}
+		dir = v
+		printDir = true
+	} else if len(args) == 2 {
+		dir = args[1]
+	} else {
+		v, ok := env.LookupVar("HOME")
+		if !ok {
+			return builtinFail(env, args, 1, "HOME not set"), nil
+		}
+		dir = v
+	}
+	wd := env.Shell.Dir
+	if len(wd) == 0 {
+		var err error
+		wd, err = os.Getwd()
+		if err != nil {
+			return builtinFail(env, args, 1, err.Error()), nil
+		}
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(wd, dir)
+	}
+	dir = filepath.Clean(dir)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return builtinFail(env, args, 1, err.Error()), nil
+	}
+	if !info.IsDir() {
+		return builtinFail(env, args, 1, "not a directory: "+dir), nil
+	}
+	env.Shell.Dir = dir
+	env.Shell.Vars["OLDPWD"] = wd
+	env.Shell.Vars["PWD"] = dir
+	env.Shell.Export("OLDPWD")
+	env.Shell.Export("PWD")
+	if printDir {
+		if _, err := fmt.Fprintln(env.stdout(), dir); err != nil {
+			return builtinWriteFail(env, args, err), nil
+		}
+	}
+	return Status{}, nil
+}
+
+func builtinExport(ctx context.Context, args []string, env Env) (Status, error) {
+	if env.Shell == nil {
+		return Status{}, ErrNoShell
+	}
+	if len(args) == 1 {
+		for _, i := range env.Shell.Environ() {
+			k := strings.IndexByte(i, '=')
+			if _, err := fmt.Fprintf(env.stdout(), "export %s=%s\n", i[0:k], Quote(i[k+1:])); err != nil {
+				return builtinWriteFail(env, args, err), nil
+			}
+		}
+		return Status{}, nil
+	}
+	status := Status{}
+	for _, i := range args[1:] {
+		name := i
+		k := strings.IndexByte(i, '=')
+		if k >= 0 {
+			name = i[0:k]
+		}
+		if parseTopEnvVar(name) != len(name) || len(name) == 0 {
+			status = builtinFail(env, args, 1, "invalid variable name: "+name)
+			continue
+		}
+		if k >= 0 {
+			env.Shell.Vars[name] = i[k+1:]
+		}
+		env.Shell.Export(name)
+	}
+	return status, nil
+}
+
+func builtinUnset(ctx context.Context, args []string, env Env) (Status, error) {
+	if env.Shell == nil {
+		return Status{}, ErrNoShell
+	}
+	for _, i := range args[1:] {
+		if i == "-v" {
+			continue
+		}
+		env.Shell.Unset(i)
+	}
+	return Status{}, nil
+}
+
+func builtinExit(ctx context.Context, args []string, env Env) (Status, error) {
+	status := env.lastStatus()
+	if len(args) > 2 {
+		return builtinFail(env, args, 1, "too many arguments"), nil
+	}
+	if len(args) == 2 {
+		k, err := strconv.Atoi(args[1])
+		if err != nil {
+			status = builtinFail(env, args, 2, "numeric argument required: "+args[1])
+		} else {
+			status = Status{
+				Code: k & 0xff,
+			}
+		}
+	}
+	return Status{}, &shellExit{
+		status: status,
+	}
+}
+
+func builtinTrue(ctx context.Context, args []string, env Env) (Status, error) {
+	return Status{}, nil
+}
+
+func builtinFalse(ctx context.Context, args []string, env Env) (Status, error) {
+	return Status{
+		Code: 1,
+	}, nil
+}
+
+func builtinEcho(ctx context.Context, args []string, env Env) (Status, error) {
+	k := args[1:]
+	newline := true
+	if len(k) > 0 && k[0] == "-n" {
+		newline = false
+		k = k[1:]
+	}
+	s := strings.Join(k, " ")
+	if newline {
+		s += "\n"
+	}
+	if _, err := io.WriteString(env.stdout(), s); err != nil {
+		return builtinWriteFail(env, args, err), nil
+	}
+	return Status{}, nil
+}
+
+// stdout returns env.Stdout, or a writer which discards output if nil
+func (env Env) stdout() io.Writer {
+	if env.Stdout == nil {
+		return io.Discard
+	}
+	return env.Stdout
+}
+
+func builtinTest(ctx context.Context, args []string, env Env) (Status, error) {
+	k := args[1:]
+	if args[0] == "[" {
+		if len(k) == 0 || k[len(k)-1] != "]" {
+			return builtinFail(env, args, 2, "missing ]"), nil
+		}
+		k = k[:len(k)-1]
+	}
+	ok, err := evalTest(env, k)
+	if err != nil {
+		return builtinFail(env, args, 2, err.Error()), nil
+	}
+	if !ok {
+		return Status{
+			Code: 1,
+		}, nil
+	}
+	return Status{}, nil
+}
+
+// evalTest evaluates the arguments of test by the number of arguments as
+// specified by POSIX
+func evalTest(env Env, args []string) (bool, error) {
+	switch len(args) {
+	case 0:
+		return false, nil
+	case 1:
+		return len(args[0]) > 0, nil
+	case 2:
+		if args[0] == "!" {
+			return len(args[1]) == 0, nil
+		}
+		return evalTestUnary(env, args[0], args[1])
+	case 3:
+		if isTestBinary(args[1]) {
+			return evalTestBinary(args[0], args[1], args[2])
+		}
+		if args[0] == "!" {
+			ok, err := evalTest(env, args[1:])
+			return !ok, err
+		}
+		if args[0] == "(" && args[2] == ")" {
+			return evalTest(env, args[1:2])
+		}
+		return false, fmt.Errorf("%s: binary operator expected", args[1])
+	case 4:
+		if args[0] == "!" {
+			ok, err := evalTest(env, args[1:])
+			return !ok, err
+		}
+		if args[0] == "(" && args[3] == ")" {
+			return evalTest(env, args[1:3])
+		}
+		return false, fmt.Errorf("too many arguments")
+	default:
+		return false, fmt.Errorf("too many arguments")
+	}
+}
+
+func evalTestUnary(env Env, op, arg string) (bool, error) {
+	switch op {
+	case "-n":
+		return len(arg) > 0, nil
+	case "-z":
+		return len(arg) == 0, nil
+	case "-e", "-f", "-d", "-s", "-x":
+		info, err := os.Stat(resolvePath(env, arg))
+		if err != nil {
+			return false, nil
+		}
+		switch op {
+		case "-f":
+			return info.Mode().IsRegular(), nil
+		case "-d":
+			return info.IsDir(), nil
+		case "-s":
+			return info.Size() > 0, nil
+		case "-x":
+			return info.Mode()&0111 != 0, nil
+		}
+		return true, nil
+	case "-h", "-L":
+		info, err := os.Lstat(resolvePath(env, arg))
+		if err != nil {
+			return false, nil
+		}
+		return info.Mode()&os.ModeSymlink != 0, nil
+	default:
+		return false, fmt.Errorf("%s: unary operator expected", op)
+	}
+}
+
+func isTestBinary(op string) bool {
+	switch op {
+	case "=", "==", "!=", "<", ">", "-eq", "-ne", "-lt", "-le", "-gt", "-ge":
+		return true
+	default:
+		return false
+	}
+}
+
+func evalTestBinary(a, op, b string) (bool, error) {
+	switch op {
+	case "=", "==":
+		return a == b, nil
+	case "!=":
+		return a != b, nil
+	case "<":
+		return a < b, nil
+	case ">":
+		return a > b, nil
+	}
+	x, err := strconv.Atoi(strings.TrimSpace(a))
+	if err != nil {
+		return false, fmt.Errorf("%s: integer expression expected", a)
+	}
+	y, err := strconv.Atoi(strings.TrimSpace(b))
+	if err != nil {
+		return false, fmt.Errorf("%s: integer expression expected", b)
+	}
+	switch op {
+	case "-eq":
+		return x == y, nil
+	case "-ne":
+		return x != y, nil
+	case "-lt":
+		return x < y, nil
+	case "-le":
+		return x <= y, nil
+	case "-gt":
+		return x > y, nil
+	default:
+		return x >= y, nil
+	}
+}
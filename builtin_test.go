@@ -0,0 +1,166 @@
+package nutcracker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Builtins(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	{
+		b := bytes.Buffer{}
+		called := []string{}
+		builtins := DefaultBuiltins()
+		builtins["greet"] = func(ctx context.Context, args []string, env Env) (Status, error) {
+			called = append(called, strings.Join(args, " "))
+			env.Stdout.Write([]byte("hello " + args[1] + "\n"))
+			return Status{Code: 3}, nil
+		}
+		n, err := Parse(`greet world | tr a-z A-Z; greet $(echo -n kevin) >/dev/null`)
+		assert.NoError(err, "Parse should not error")
+		status, err := n.Exec(Env{Builtins: builtins, Ex: NewExecutor(), Stdout: &b})
+		assert.NoError(err, "script should not error")
+		assert.Equal(3, status.Code, "status of the builtin should be returned")
+		assert.Equal("HELLO WORLD\n", b.String(), "builtins should use the stdio of the env")
+		assert.Equal([]string{"greet world", "greet kevin"}, called, "builtins should be called with args")
+	}
+	{
+		b := bytes.Buffer{}
+		n, err := Parse(`true && echo -n a b; false || echo " c"; echo -n`)
+		assert.NoError(err, "Parse should not error")
+		status, err := n.Exec(Env{Builtins: DefaultBuiltins()})
+		assert.NoError(err, "script should not error without stdout")
+		assert.True(status.Success(), "script should succeed")
+		_, err = n.Exec(Env{Builtins: DefaultBuiltins(), Stdout: &b})
+		assert.NoError(err, "script should not error")
+		assert.Equal("a b c\n", b.String(), "echo should write args")
+	}
+	{
+		b := bytes.Buffer{}
+		n, err := Parse(`echo $X | true`)
+		assert.NoError(err, "Parse should not error")
+		env := Env{Vars: map[string]string{"X": strings.Repeat("x", 1<<20)}, Builtins: DefaultBuiltins(), Stdout: &b, Pipefail: true}
+		status, err := n.Exec(env)
+		assert.NoError(err, "writing to an exited reader should not error")
+		assert.Equal(Status{Code: 141}, status, "writing to an exited reader should exit with SIGPIPE")
+	}
+	{
+		b := bytes.Buffer{}
+		r, w, err := os.Pipe()
+		assert.NoError(err, "pipe should be created")
+		r.Close()
+		w.Close()
+		n, err := Parse(`echo a; echo after >&2`)
+		assert.NoError(err, "Parse should not error")
+		status, err := n.Exec(Env{Builtins: DefaultBuiltins(), Stdout: w, Stderr: &b})
+		assert.NoError(err, "write errors should not error")
+		assert.True(status.Success(), "script should continue after a write error")
+		assert.True(strings.HasPrefix(b.String(), "echo: write error: "), "write errors should be written to stderr")
+		assert.True(strings.HasSuffix(b.String(), "\nafter\n"), "script should continue after a write error")
+	}
+	{
+		n, err := Parse(`cd /`)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Builtins: DefaultBuiltins()})
+		assert.True(errors.Is(err, ErrNoShell), "builtins modifying shell state should require a shell")
+	}
+	{
+		b := bytes.Buffer{}
+		s := NewShell(Env{Envvar: []string{"PATH=" + os.Getenv("PATH")}, Ex: NewExecutor(), Stdout: &b, Stderr: &b})
+		_, err := s.Run(ctx, `export A=1 B; B=2; C=3; export; sh -c 'echo $A $B $C'; unset A C; export; echo "$A$C"; export 1x`)
+		assert.NoError(err, "Run should not error")
+		assert.Equal("export A=1\nexport B=2\nexport PATH="+Quote(os.Getenv("PATH"))+"\n1 2\nexport B=2\nexport PATH="+Quote(os.Getenv("PATH"))+"\n\nexport: invalid variable name: 1x\n", b.String(), "export and unset should modify shell variables")
+		assert.Equal(1, s.Status.Code, "export should fail on invalid names")
+	}
+	{
+		b := bytes.Buffer{}
+		s := NewShell(Env{Envvar: []string{}, Stdout: &b})
+		status, err := s.Run(ctx, "echo a; exit 3; echo b")
+		assert.NoError(err, "Run should not error")
+		assert.Equal(3, status.Code, "exit should return its status")
+		assert.Equal("a\n", b.String(), "exit should stop the script")
+		status, err = s.Run(ctx, "false; exit")
+		assert.NoError(err, "Run should not error")
+		assert.Equal(1, status.Code, "exit should default to the last status")
+		status, err = s.Run(ctx, "exit 2 | true; echo $(exit 0) c; exit 256")
+		assert.NoError(err, "Run should not error")
+		assert.Equal(0, status.Code, "exit status should be truncated")
+		assert.Equal("a\nc\n", b.String(), "exit in a subshell should only exit the subshell")
+	}
+	{
+		dir := t.TempDir()
+		assert.NoError(os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello\n"), 0644), "file should be created")
+		assert.NoError(os.WriteFile(filepath.Join(dir, "empty.txt"), []byte{}, 0755), "file should be created")
+		assert.NoError(os.Mkdir(filepath.Join(dir, "sub"), 0755), "dir should be created")
+
+		for _, i := range []struct {
+			arg  string
+			code int
+		}{
+			{`test`, 1},
+			{`test a`, 0},
+			{`test ''`, 1},
+			{`test ! ''`, 0},
+			{`test -n a`, 0},
+			{`test -z a`, 1},
+			{`[ a = a ]`, 0},
+			{`[ a != a ]`, 1},
+			{`[ a == b ]`, 1},
+			{`[ 2 -lt 10 ]`, 0},
+			{`[ 2 -ge 10 ]`, 1},
+			{`[ 3 -eq 3 ]`, 0},
+			{`[ ! 3 -eq 3 ]`, 1},
+			{`[ "(" a ")" ]`, 0},
+			{`[ -f file.txt ]`, 0},
+			{`[ -d file.txt ]`, 1},
+			{`[ -d sub ]`, 0},
+			{`[ -e bogus ]`, 1},
+			{`[ -s file.txt ]`, 0},
+			{`[ -s empty.txt ]`, 1},
+			{`[ -x empty.txt ]`, 0},
+			{`[ -h file.txt ]`, 1},
+			{`[ a -eq 1 ]`, 2},
+			{`[ a -bogus b ]`, 2},
+			{`[ -bogus a ]`, 2},
+			{`[ a`, 2},
+			{`test a b c d e`, 2},
+		} {
+			n, err := Parse(i.arg)
+			assert.NoError(err, "Parse should not error")
+			status, err := n.Exec(Env{Builtins: DefaultBuiltins(), Dir: dir})
+			assert.NoError(err, "test should not error")
+			assert.Equal(i.code, status.Code, "%s should exit with %d", i.arg, i.code)
+		}
+	}
+	{
+		dir := t.TempDir()
+		assert.NoError(os.Mkdir(filepath.Join(dir, "sub"), 0755), "dir should be created")
+		assert.NoError(os.WriteFile(filepath.Join(dir, "sub", "file.txt"), []byte("hello\n"), 0644), "file should be created")
+
+		b := bytes.Buffer{}
+		s := NewShell(Env{Envvar: []string{"PATH=" + os.Getenv("PATH"), "HOME=" + dir}, Ex: NewExecutor(), Stdout: &b, Stderr: &b})
+		s.Dir = "/"
+		_, err := s.Run(ctx, `cd; cd sub; cat file.txt; echo $PWD $OLDPWD; sh -c 'echo $PWD'; cd ..; cd -`)
+		assert.NoError(err, "Run should not error")
+		sub := filepath.Join(dir, "sub")
+		assert.Equal("hello\n"+sub+" "+dir+"\n"+sub+"\n"+sub+"\n", b.String(), "cd should change the working directory")
+		assert.Equal(sub, s.Dir, "cd should set the shell dir")
+		b.Reset()
+		_, err = s.Run(ctx, `cd bogus`)
+		assert.NoError(err, "Run should not error")
+		assert.Equal(1, s.Status.Code, "cd should fail on missing dirs")
+		_, err = s.Run(ctx, `cd file.txt`)
+		assert.NoError(err, "Run should not error")
+		assert.Equal(1, s.Status.Code, "cd should fail on files")
+		assert.Equal(sub, s.Dir, "failed cd should not change the shell dir")
+		assert.Contains(b.String(), "cd: not a directory", "cd should fail on files")
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 const (
 	spaceCharSet = " \t\r\n"
+	blankCharSet = " \t\r"
 )
 
 func isSpace(c byte) bool {
@@ -18,17 +19,26 @@ func isSpace(c byte) bool {
 	}
 }
 
+func isIFSSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n':
+		return true
+	default:
+		return false
+	}
+}
+
 func trimLSpace(s string) string {
 	return strings.TrimLeft(s, spaceCharSet)
 }
 
-func nextSpace(s string) int {
-	return strings.IndexAny(s, spaceCharSet)
+func trimLBlank(s string) string {
+	return strings.TrimLeft(s, blankCharSet)
 }
 
 func isSpecialStrI(c byte) bool {
 	switch c {
-	case '$', '"', '\\', '\n':
+	case '$', '`', '"', '\\', '\n':
 		return true
 	default:
 		return false
@@ -97,3 +107,90 @@ var (
 func parseTopEnvVar(s string) int {
 	return len(regexFindEnv.FindString(s))
 }
+
+var (
+	regexFindParam = regexp.MustCompile(`^(?:[a-zA-Z_][a-zA-Z0-9_]*|[0-9]+|[@*#?$])`)
+)
+
+// parseTopParam returns the length of the variable, positional parameter, or
+// special parameter name at the beginning of s
+func parseTopParam(s string) int {
+	return len(regexFindParam.FindString(s))
+}
+
+// isSpecialParam reports whether c is the name of a special parameter, which
+// may be referenced without braces
+func isSpecialParam(c byte) bool {
+	switch c {
+	case '@', '*', '#', '?', '$':
+		return true
+	default:
+		return false
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isParamName reports whether name is a positional or special parameter
+func isParamName(name string) bool {
+	return len(name) > 0 && (isDigit(name[0]) || isSpecialParam(name[0]))
+}
+
+var (
+	varOps = []string{":-", ":=", ":?", ":+", "-", "=", "?", "+", "##", "#", "%%", "%"}
+)
+
+// parseVarOp returns the parameter expansion operator at the beginning of s
+func parseVarOp(s string) string {
+	for _, i := range varOps {
+		if strings.HasPrefix(s, i) {
+			return i
+		}
+	}
+	return ""
+}
+
+func isOperator(c byte) bool {
+	switch c {
+	case '|', '&', ';', '<', '>':
+		return true
+	default:
+		return false
+	}
+}
+
+// isArgEnd reports whether c ends an argument in the mode, where '}' closes
+// a variable or brace expansion, and ',' separates the words of a brace
+// expansion
+func isArgEnd(c byte, mode int) bool {
+	switch c {
+	case '}':
+		return mode == argModeVar || mode == argModeBrace
+	case ',':
+		return mode == argModeBrace
+	default:
+		return false
+	}
+}
+
+func isSpecialArg(c byte) bool {
+	switch c {
+	case '\\', '"', '\'', '$', '`', '(', ')', '{', '}':
+		return true
+	default:
+		return false
+	}
+}
+
+// isGlobChar reports whether c is a pattern character of a glob, which must
+// be escaped to be literal
+func isGlobChar(c byte) bool {
+	switch c {
+	case '*', '?', '[', ']':
+		return true
+	default:
+		return false
+	}
+}
@@ -1,7 +1,66 @@
 package nutcracker
 
+import (
+	"fmt"
+	"strings"
+)
+
 type (
 	internalError int
+
+	// ExitError is returned when a command exits with a non-zero status where
+	// a successful exit is required
+	ExitError struct {
+		Status Status
+	}
+
+	// StartError is returned when a command could not be started
+	StartError struct {
+		Args []string
+		Err  error
+	}
+
+	// ParseError is returned when the source text could not be parsed. Err is
+	// one of the parse errors defined by this package, and Snippet is the
+	// source text beginning at Pos up to the end of the line.
+	ParseError struct {
+		Pos     Pos
+		Snippet string
+		Err     error
+	}
+
+	// ParamError is returned by a ${name?word} or ${name:?word} parameter
+	// expansion, where Message is the value of word
+	ParamError struct {
+		Pos     Pos
+		Name    string
+		Message string
+	}
+
+	// ArithError is returned when an arithmetic expansion is invalid or
+	// divides by zero
+	ArithError struct {
+		Pos     Pos
+		Expr    string
+		Message string
+	}
+
+	// GlobError is returned when a pattern matches no paths and
+	// Env.Failglob is set
+	GlobError struct {
+		Pattern string
+	}
+
+	// UnsetVariableError is returned when an unset variable is referenced
+	// without a default and Env.Nounset is set
+	UnsetVariableError struct {
+		Pos  Pos
+		Name string
+	}
+)
+
+const (
+	parseErrSnippetLen = 32
 )
 
 const (
@@ -16,6 +75,12 @@ const (
 	ErrInvalidVar
 	ErrInvalidArgMode
 	ErrInvalidExec
+	ErrInvalidPipe
+	ErrInvalidRedirect
+	ErrInvalidOperator
+	ErrInvalidExpansion
+	ErrNoShell
+	ErrUnclosedBacktick
 )
 
 func (e internalError) Error() string {
@@ -40,7 +105,65 @@ func (e internalError) Error() string {
 		return "invalid argument mode"
 	case ErrInvalidExec:
 		return "invalid command to execute"
+	case ErrInvalidPipe:
+		return "missing command in pipeline"
+	case ErrInvalidRedirect:
+		return "invalid redirect"
+	case ErrInvalidOperator:
+		return "invalid operator"
+	case ErrInvalidExpansion:
+		return "expansion not allowed"
+	case ErrNoShell:
+		return "builtin requires a shell"
+	case ErrUnclosedBacktick:
+		return "unclosed backquote"
 	default:
 		return "nutcracker error"
 	}
 }
+
+func (e *ExitError) Error() string {
+	if e.Status.Canceled {
+		return "command canceled"
+	}
+	if e.Status.Signal != 0 {
+		return "command terminated by signal: " + e.Status.Signal.String()
+	}
+	return fmt.Sprintf("command exited with status %d", e.Status.Code)
+}
+
+func (e *StartError) Error() string {
+	return fmt.Sprintf("failed to start command %s: %s", strings.Join(e.Args, " "), e.Err.Error())
+}
+
+func (e *StartError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%d:%d: %s near %q", e.Pos.Line, e.Pos.Col, e.Err.Error(), e.Snippet)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ParamError) Error() string {
+	msg := e.Message
+	if len(msg) == 0 {
+		msg = "parameter null or not set"
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", e.Pos.Line, e.Pos.Col, e.Name, msg)
+}
+
+func (e *UnsetVariableError) Error() string {
+	return fmt.Sprintf("%d:%d: %s: unset variable", e.Pos.Line, e.Pos.Col, e.Name)
+}
+
+func (e *ArithError) Error() string {
+	return fmt.Sprintf("%d:%d: %s: %s", e.Pos.Line, e.Pos.Col, e.Expr, e.Message)
+}
+
+func (e *GlobError) Error() string {
+	return "no match: " + e.Pattern
+}
@@ -1,7 +1,9 @@
 package nutcracker
 
 import (
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"syscall"
 	"testing"
 )
 
@@ -18,5 +20,61 @@ func Test_Error_Error(t *testing.T) {
 	assert.NotEqual("", ErrInvalidVar.Error(), "error should not be empty")
 	assert.NotEqual("", ErrInvalidArgMode.Error(), "error should not be empty")
 	assert.NotEqual("", ErrInvalidExec.Error(), "error should not be empty")
+	assert.NotEqual("", ErrInvalidPipe.Error(), "error should not be empty")
+	assert.NotEqual("", ErrInvalidRedirect.Error(), "error should not be empty")
+	assert.NotEqual("", ErrInvalidOperator.Error(), "error should not be empty")
+	assert.NotEqual("", ErrInvalidExpansion.Error(), "error should not be empty")
+	assert.NotEqual("", ErrNoShell.Error(), "error should not be empty")
+	assert.NotEqual("", ErrUnclosedBacktick.Error(), "error should not be empty")
 	assert.NotEqual("", internalError(0).Error(), "error should not be empty")
 }
+
+func Test_ExitError_Error(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("command exited with status 3", (&ExitError{Status: Status{Code: 3}}).Error(), "exit error should contain the exit code")
+	assert.Contains((&ExitError{Status: Status{Code: 137, Signal: syscall.SIGKILL}}).Error(), "killed", "exit error should contain the signal")
+	assert.Equal("command canceled", (&ExitError{Status: Status{Code: 137, Signal: syscall.SIGKILL, Canceled: true}}).Error(), "exit error should report cancelation")
+}
+
+func Test_StartError_Error(t *testing.T) {
+	assert := assert.New(t)
+
+	inner := errors.New("not found")
+	err := &StartError{Args: []string{"bogus", "hello"}, Err: inner}
+	assert.Equal("failed to start command bogus hello: not found", err.Error(), "start error should contain the command and cause")
+	assert.Equal(inner, errors.Unwrap(err), "start error should unwrap to its cause")
+}
+
+func Test_ParseError_Error(t *testing.T) {
+	assert := assert.New(t)
+
+	err := &ParseError{Pos: Pos{Offset: 16, Line: 2, Col: 6}, Snippet: `"world`, Err: ErrUnclosedStrI}
+	assert.Equal(`2:6: unclosed double quote near "\"world"`, err.Error(), "parse error should contain its position")
+	assert.Equal(ErrUnclosedStrI, errors.Unwrap(err), "parse error should unwrap to its cause")
+}
+
+func Test_ParamError_Error(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("1:6: name: missing name", (&ParamError{Pos: Pos{Offset: 5, Line: 1, Col: 6}, Name: "name", Message: "missing name"}).Error(), "param error should contain its position and message")
+	assert.Equal("1:6: name: parameter null or not set", (&ParamError{Pos: Pos{Offset: 5, Line: 1, Col: 6}, Name: "name"}).Error(), "param error should have a default message")
+}
+
+func Test_UnsetVariableError_Error(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("2:3: name: unset variable", (&UnsetVariableError{Pos: Pos{Offset: 8, Line: 2, Col: 3}, Name: "name"}).Error(), "unset variable error should contain its position and name")
+}
+
+func Test_GlobError_Error(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("no match: *.go", (&GlobError{Pattern: "*.go"}).Error(), "glob error should contain the pattern")
+}
+
+func Test_ArithError_Error(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("1:3: 1 / 0: division by zero", (&ArithError{Pos: Pos{Offset: 2, Line: 1, Col: 3}, Expr: "1 / 0", Message: "division by zero"}).Error(), "arith error should contain its position, expression, and message")
+}
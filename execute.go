@@ -1,31 +1,114 @@
 package nutcracker
 
 import (
+	"context"
+	"os"
 	"os/exec"
+	"syscall"
+	"time"
 )
 
 type (
+	// Status is the exit status of a command
+	Status struct {
+		// Code is the exit code of the command. By shell convention, it is 128
+		// plus the signal number if the command was terminated by a signal.
+		Code int
+		// Signal is the signal which terminated the command, and is 0 if the
+		// command exited normally.
+		Signal syscall.Signal
+		// Canceled is true if the command was killed because its context was
+		// done.
+		Canceled bool
+	}
+
+	// Executor runs commands. Exec returns the exit status of the command if
+	// it was run, and a *StartError if the command could not be started. The
+	// command should be terminated if ctx is done before it exits.
 	Executor interface {
-		Exec(args []string, env Env) error
+		Exec(ctx context.Context, args []string, env Env) (Status, error)
 	}
 
 	executor struct {
+		grace time.Duration
 	}
 )
 
+// Success reports whether the command exited with a zero exit code and was
+// not canceled
+func (s Status) Success() bool {
+	return s.Code == 0 && !s.Canceled
+}
+
+// Err returns an *ExitError if the command exited with a non-zero status
+func (s Status) Err() error {
+	if s.Success() {
+		return nil
+	}
+	return &ExitError{
+		Status: s,
+	}
+}
+
+// statusFromState converts the state of an exited process into a Status
+func statusFromState(state *os.ProcessState) Status {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return Status{
+			Code:   128 + int(ws.Signal()),
+			Signal: ws.Signal(),
+		}
+	}
+	return Status{
+		Code: state.ExitCode(),
+	}
+}
+
+// NewExecutor creates an Executor which runs commands as processes. Processes
+// are killed immediately when their context is done.
 func NewExecutor() Executor {
 	return &executor{}
 }
 
-func (e executor) Exec(args []string, env Env) error {
+// NewExecutorGrace creates an Executor which runs commands as processes. When
+// the context of a process is done, it is sent SIGTERM, and then killed if it
+// has not exited after the grace period.
+func NewExecutorGrace(grace time.Duration) Executor {
+	return &executor{
+		grace: grace,
+	}
+}
+
+func (e executor) Exec(ctx context.Context, args []string, env Env) (Status, error) {
 	if args == nil || len(args) < 1 {
-		return ErrInvalidExec
+		return Status{}, ErrInvalidExec
 	}
 
-	cmd := exec.Command(args[0], args[1:]...)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if e.grace > 0 {
+		cmd.Cancel = func() error {
+			return cmd.Process.Signal(syscall.SIGTERM)
+		}
+		cmd.WaitDelay = e.grace
+	}
 	cmd.Stdin = env.Stdin
 	cmd.Stdout = env.Stdout
 	cmd.Stderr = env.Stderr
 	cmd.Env = env.Envvar
-	return cmd.Run()
+	cmd.Dir = env.Dir
+	if err := cmd.Start(); err != nil {
+		return Status{}, &StartError{
+			Args: args,
+			Err:  err,
+		}
+	}
+	err := cmd.Wait()
+	status := statusFromState(cmd.ProcessState)
+	if err != nil {
+		if ctx.Err() != nil {
+			status.Canceled = true
+		} else if _, ok := err.(*exec.ExitError); !ok {
+			return Status{}, err
+		}
+	}
+	return status, nil
 }
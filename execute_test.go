@@ -1,8 +1,13 @@
 package nutcracker
 
 import (
+	"bytes"
+	"context"
 	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func Test_Executor_Exec(t *testing.T) {
@@ -10,7 +15,76 @@ func Test_Executor_Exec(t *testing.T) {
 
 	{
 		exec := NewExecutor()
-		err := exec.Exec([]string{}, Env{})
+		_, err := exec.Exec(context.Background(), []string{}, Env{})
 		assert.Equal(ErrInvalidExec, err, "executor must be run with a command")
 	}
+	{
+		exec := NewExecutor()
+		b := bytes.Buffer{}
+		status, err := exec.Exec(context.Background(), []string{"echo", "hello"}, Env{Stdout: &b})
+		assert.NoError(err, "executor should not error")
+		assert.Equal(Status{}, status, "successful command should have a zero status")
+		assert.True(status.Success(), "successful command should succeed")
+		assert.NoError(status.Err(), "successful command should not have an exit error")
+		assert.Equal("hello\n", b.String(), "executor should write to stdout")
+	}
+	{
+		exec := NewExecutor()
+		status, err := exec.Exec(context.Background(), []string{"sh", "-c", "exit 3"}, Env{})
+		assert.NoError(err, "executor should not error on non-zero exit")
+		assert.Equal(Status{Code: 3}, status, "exit code should be returned")
+		assert.False(status.Success(), "non-zero exit should not succeed")
+		assert.Equal(&ExitError{Status: Status{Code: 3}}, status.Err(), "non-zero exit should have an exit error")
+	}
+	{
+		exec := NewExecutor()
+		status, err := exec.Exec(context.Background(), []string{"sh", "-c", "kill -9 $$"}, Env{})
+		assert.NoError(err, "executor should not error on signal")
+		assert.Equal(Status{Code: 128 + 9, Signal: syscall.SIGKILL}, status, "terminating signal should be returned")
+	}
+	{
+		exec := NewExecutor()
+		_, err := exec.Exec(context.Background(), []string{"bogus"}, Env{})
+		assert.Error(err, "executor should error on command that cannot be started")
+		startErr, ok := err.(*StartError)
+		assert.True(ok, "executor should return a start error")
+		assert.Equal([]string{"bogus"}, startErr.Args, "start error should contain the command")
+	}
+	{
+		exec := NewExecutor()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		status, err := exec.Exec(ctx, []string{"sleep", "10"}, Env{})
+		assert.NoError(err, "executor should not error on cancel")
+		assert.True(status.Canceled, "command should be canceled")
+		assert.Equal(syscall.SIGKILL, status.Signal, "command should be killed")
+		assert.False(status.Success(), "canceled command should not succeed")
+		assert.True(time.Since(start) < 5*time.Second, "command should be killed on cancel")
+	}
+	{
+		exec := NewExecutorGrace(5 * time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		status, err := exec.Exec(ctx, []string{"sh", "-c", "trap 'exit 0' TERM; while true; do sleep 0.01; done"}, Env{})
+		assert.NoError(err, "executor should not error on cancel")
+		assert.Equal(Status{Code: 0, Canceled: true}, status, "command should be allowed to exit on SIGTERM")
+		assert.False(status.Success(), "canceled command should not succeed")
+	}
+	{
+		exec := NewExecutorGrace(50 * time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		status, err := exec.Exec(ctx, []string{"sh", "-c", "trap '' TERM; while true; do sleep 0.01; done"}, Env{})
+		assert.NoError(err, "executor should not error on cancel")
+		assert.Equal(Status{Code: 128 + 9, Signal: syscall.SIGKILL, Canceled: true}, status, "command should be killed after the grace period")
+	}
+	{
+		b := bytes.Buffer{}
+		dir, err := filepath.EvalSymlinks(t.TempDir())
+		assert.NoError(err, "temp dir should be resolved")
+		_, err = NewExecutor().Exec(context.Background(), []string{"pwd"}, Env{Dir: dir, Stdout: &b})
+		assert.NoError(err, "executor should not error")
+		assert.Equal(dir+"\n", b.String(), "command should run in the env dir")
+	}
 }
@@ -0,0 +1,131 @@
+package nutcracker
+
+import (
+	"strings"
+)
+
+const (
+	defaultIFS = " \t\n"
+)
+
+// FieldSeparator returns the characters on which the results of unquoted
+// expansions are split. It is env.IFS if non-empty, and otherwise the value of
+// the IFS variable if set, defaulting to space, tab, and newline. A set but
+// empty IFS variable disables splitting.
+func (env Env) FieldSeparator() string {
+	if len(env.IFS) > 0 {
+		return env.IFS
+	}
+	if v, ok := env.LookupVar("IFS"); ok {
+		return v
+	}
+	return defaultIFS
+}
+
+type (
+	// fieldBuilder builds fields from text and split expansions following
+	// POSIX field splitting. Alongside each field, it builds a pattern in
+	// which only unquoted pattern characters are active, which is empty if
+	// the field has none.
+	fieldBuilder struct {
+		ifs      string
+		fields   []string
+		patterns []string
+		s        strings.Builder
+		p        strings.Builder
+		// field is true if a field has been started, which may be empty
+		field bool
+		// glob is true if the field has unquoted pattern characters
+		glob bool
+	}
+)
+
+func newFieldBuilder(ifs string) *fieldBuilder {
+	return &fieldBuilder{
+		ifs:      ifs,
+		fields:   []string{},
+		patterns: []string{},
+	}
+}
+
+func (b *fieldBuilder) isIFSSpace(c byte) bool {
+	return isIFSSpace(c) && strings.IndexByte(b.ifs, c) >= 0
+}
+
+func (b *fieldBuilder) isIFSDelim(c byte) bool {
+	return !isIFSSpace(c) && strings.IndexByte(b.ifs, c) >= 0
+}
+
+// writeText appends text to the current field without splitting
+func (b *fieldBuilder) writeText(v string) {
+	b.s.WriteString(v)
+	b.p.WriteString(escapePattern(v))
+	b.field = true
+}
+
+// writeGlob appends unquoted text with the value v and pattern to the
+// current field without splitting
+func (b *fieldBuilder) writeGlob(v string, pattern string) {
+	b.s.WriteString(v)
+	b.p.WriteString(pattern)
+	b.field = true
+	b.glob = true
+}
+
+// writeSplit appends text to the current field, splitting it into new fields
+// on the field separator. IFS whitespace is ignored at the beginning and end
+// of fields, and each non-whitespace IFS character delimits a field, such that
+// adjacent ones produce empty fields.
+func (b *fieldBuilder) writeSplit(v string) {
+	for i := 0; i < len(v); {
+		c := v[i]
+		if !b.isIFSSpace(c) && !b.isIFSDelim(c) {
+			b.s.WriteByte(c)
+			// the results of unquoted expansions may contain pattern
+			// characters, but not escapes
+			if c == '\\' {
+				b.p.WriteByte('\\')
+			} else if c == '*' || c == '?' || c == '[' {
+				b.glob = true
+			}
+			b.p.WriteByte(c)
+			b.field = true
+			i++
+			continue
+		}
+		for i < len(v) && b.isIFSSpace(v[i]) {
+			i++
+		}
+		if i < len(v) && b.isIFSDelim(v[i]) {
+			i++
+			for i < len(v) && b.isIFSSpace(v[i]) {
+				i++
+			}
+			b.delimit()
+		} else if b.field {
+			b.delimit()
+		}
+	}
+}
+
+// delimit ends the current field
+func (b *fieldBuilder) delimit() {
+	b.fields = append(b.fields, b.s.String())
+	if b.glob && hasGlobMeta(b.p.String()) {
+		b.patterns = append(b.patterns, b.p.String())
+	} else {
+		b.patterns = append(b.patterns, "")
+	}
+	b.s.Reset()
+	b.p.Reset()
+	b.field = false
+	b.glob = false
+}
+
+// done ends the current field if one has been started and returns all fields
+func (b *fieldBuilder) done() []string {
+	if b.field {
+		b.delimit()
+	}
+	return b.fields
+}
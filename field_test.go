@@ -0,0 +1,95 @@
+package nutcracker
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Env_FieldSeparator(t *testing.T) {
+	assert := assert.New(t)
+
+	envfunc := func(s string) string {
+		if s == "IFS" {
+			return ","
+		}
+		return ""
+	}
+	assert.Equal(" \t\n", Env{}.FieldSeparator(), "field separator should default to whitespace")
+	assert.Equal(":", Env{IFS: ":", Envfunc: envfunc}.FieldSeparator(), "explicit field separator should take precedence")
+	assert.Equal(",", Env{Envfunc: envfunc, Envvar: []string{"IFS=:"}}.FieldSeparator(), "envfunc should take precedence over envvar")
+	assert.Equal(":", Env{Envvar: []string{"IFS=,", "HOME=/", "IFS=:"}}.FieldSeparator(), "the last IFS envvar should be used")
+	assert.Equal("", Env{Envvar: []string{"IFS="}}.FieldSeparator(), "set but empty IFS should disable splitting")
+	assert.Equal(" \t\n", Env{Envfunc: func(string) string { return "" }}.FieldSeparator(), "empty IFS from envfunc should be treated as unset")
+}
+
+func Test_fieldBuilder(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, i := range []struct {
+		ifs    string
+		v      string
+		fields []string
+	}{
+		{ifs: " \t\n", v: "  a \t b\nc  ", fields: []string{"a", "b", "c"}},
+		{ifs: " \t\n", v: "   ", fields: []string{}},
+		{ifs: ":", v: "a:b::c", fields: []string{"a", "b", "", "c"}},
+		{ifs: ":", v: ":a:", fields: []string{"", "a"}},
+		{ifs: ":", v: ":", fields: []string{""}},
+		{ifs: ":", v: "a b", fields: []string{"a b"}},
+		{ifs: ": ", v: " a : b  c :: d ", fields: []string{"a", "b", "c", "", "d"}},
+		{ifs: ": ", v: " : a", fields: []string{"", "a"}},
+		{ifs: ",", v: "a,,", fields: []string{"a", ""}},
+		{ifs: "", v: " a b ", fields: []string{" a b "}},
+	} {
+		b := newFieldBuilder(i.ifs)
+		b.writeSplit(i.v)
+		assert.Equal(i.fields, b.done(), "fields should be split for %q on %q", i.v, i.ifs)
+	}
+	{
+		b := newFieldBuilder(":")
+		b.writeText("x")
+		b.writeSplit(":a:")
+		b.writeText("y")
+		assert.Equal([]string{"x", "a", "y"}, b.done(), "split text should delimit adjacent text")
+	}
+}
+
+func Test_Arg_Fields_IFS(t *testing.T) {
+	assert := assert.New(t)
+
+	exec := NewExecutor()
+	envfunc := func(s string) string {
+		switch s {
+		case "path":
+			return "/bin:/usr/bin::/sbin"
+		case "IFS":
+			return ":"
+		}
+		return ""
+	}
+	{
+		arg := `$path`
+		n, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		fields, err := n.Fields(context.Background(), Env{Envfunc: envfunc, Ex: exec})
+		assert.NoError(err, "node fields should not error")
+		assert.Equal([]string{"/bin", "/usr/bin", "", "/sbin"}, fields, "fields should be split on IFS")
+	}
+	{
+		arg := `"$path"`
+		n, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		fields, err := n.Fields(context.Background(), Env{Envfunc: envfunc, Ex: exec})
+		assert.NoError(err, "node fields should not error")
+		assert.Equal([]string{"/bin:/usr/bin::/sbin"}, fields, "quoted fields should not be split")
+	}
+	{
+		arg := `$(printf 'a,b c,')`
+		n, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		fields, err := n.Fields(context.Background(), Env{IFS: ",", Ex: exec})
+		assert.NoError(err, "node fields should not error")
+		assert.Equal([]string{"a", "b c"}, fields, "command substitution should be split on IFS")
+	}
+}
@@ -0,0 +1,202 @@
+package nutcracker
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type (
+	// Glob is unquoted text containing pattern characters, where Pattern is
+	// the source text including escapes. It evaluates to the text itself, and
+	// is expanded to matching paths as a field of a command.
+	Glob struct {
+		span
+		Pattern string
+	}
+)
+
+func newGlob(pattern string) *Glob {
+	return &Glob{
+		Pattern: pattern,
+	}
+}
+
+func (n Glob) Value(ctx context.Context, env Env) (string, error) {
+	return unescapePattern(n.Pattern), nil
+}
+
+// hasGlobMeta reports whether the pattern contains unescaped pattern
+// characters. An unclosed '[' is not a pattern character.
+func hasGlobMeta(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '*', '?':
+			return true
+		case '[':
+			if _, n := matchClass(pattern[i:], 0); n > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unescapePattern removes the escapes of a pattern
+func unescapePattern(pattern string) string {
+	s := strings.Builder{}
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+		s.WriteByte(pattern[i])
+	}
+	return s.String()
+}
+
+// expandGlob returns the fields with each pattern replaced by the paths it
+// matches. A pattern without matches is removed if env.Nullglob is set,
+// returns a *GlobError if env.Failglob is set, and is otherwise left as is.
+func (env Env) expandGlob(fields []string, patterns []string) ([]string, error) {
+	k := make([]string, 0, len(fields))
+	for n, i := range fields {
+		if len(patterns[n]) == 0 {
+			k = append(k, i)
+			continue
+		}
+		matches, err := env.Glob(patterns[n])
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) > 0 {
+			k = append(k, matches...)
+		} else if env.Failglob {
+			return nil, &GlobError{
+				Pattern: patterns[n],
+			}
+		} else if !env.Nullglob {
+			k = append(k, i)
+		}
+	}
+	return k, nil
+}
+
+// Glob returns the sorted paths matching the pattern, relative to the working
+// directory of env. Paths are matched against env.FS if it is non-nil, where
+// the root of env.FS is '/', and otherwise against the filesystem of the
+// process. A leading '.' of a file
+// name must be matched explicitly.
+func (env Env) Glob(pattern string) ([]string, error) {
+	segments := strings.Split(pattern, "/")
+	bases := []string{""}
+	if len(segments[0]) == 0 {
+		// an absolute pattern begins with an empty segment
+		bases = []string{"/"}
+		segments = segments[1:]
+	}
+	for n, seg := range segments {
+		last := n == len(segments)-1
+		if len(seg) == 0 {
+			if last {
+				// a trailing slash matches only directories
+				k := []string{}
+				for _, i := range bases {
+					if info, err := env.statGlob(i); err == nil && info.IsDir() {
+						k = append(k, i)
+					}
+				}
+				bases = k
+			}
+			continue
+		}
+		k := []string{}
+		if !hasGlobMeta(seg) {
+			name := unescapePattern(seg)
+			for _, i := range bases {
+				p := joinGlob(i, name)
+				if last || strings.HasSuffix(pattern, "/") {
+					if _, err := env.statGlob(p); err != nil {
+						continue
+					}
+				}
+				k = append(k, p)
+			}
+			bases = k
+			continue
+		}
+		for _, i := range bases {
+			entries, err := env.readDirGlob(i)
+			if err != nil {
+				continue
+			}
+			for _, j := range entries {
+				name := j.Name()
+				if name[0] == '.' && seg[0] != '.' {
+					continue
+				}
+				if !last && !j.IsDir() && j.Type()&fs.ModeSymlink == 0 {
+					continue
+				}
+				if matchPattern(seg, name) {
+					k = append(k, joinGlob(i, name))
+				}
+			}
+		}
+		bases = k
+	}
+	if strings.HasSuffix(pattern, "/") {
+		for n, i := range bases {
+			bases[n] = i + "/"
+		}
+	}
+	sort.Strings(bases)
+	return bases, nil
+}
+
+// joinGlob joins a matched base path and a file name
+func joinGlob(base, name string) string {
+	if len(base) == 0 {
+		return name
+	}
+	if strings.HasSuffix(base, "/") {
+		return base + name
+	}
+	return base + "/" + name
+}
+
+// fsPath converts a matched path to a path of env.FS, where the root of
+// env.FS is '/', and relative paths are resolved against the working
+// directory of env
+func (env Env) fsPath(p string) string {
+	dir := env.Dir
+	if env.Shell != nil {
+		dir = env.Shell.Dir
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(filepath.ToSlash(dir), p)
+	}
+	return path.Clean(strings.TrimPrefix(p, "/"))
+}
+
+func (env Env) readDirGlob(p string) ([]fs.DirEntry, error) {
+	if env.FS != nil {
+		return fs.ReadDir(env.FS, env.fsPath(p))
+	}
+	if len(p) == 0 {
+		p = "."
+	}
+	return os.ReadDir(resolvePath(env, p))
+}
+
+func (env Env) statGlob(p string) (fs.FileInfo, error) {
+	if env.FS != nil {
+		return fs.Stat(env.FS, env.fsPath(p))
+	}
+	return os.Stat(resolvePath(env, p))
+}
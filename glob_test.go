@@ -0,0 +1,165 @@
+package nutcracker
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_hasGlobMeta(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, i := range []struct {
+		pattern string
+		meta    bool
+	}{
+		{pattern: "abc", meta: false},
+		{pattern: "*.go", meta: true},
+		{pattern: "a?c", meta: true},
+		{pattern: "[ab]c", meta: true},
+		{pattern: "[ab", meta: false},
+		{pattern: "[", meta: false},
+		{pattern: `\*.go`, meta: false},
+		{pattern: `a\?\[b]`, meta: false},
+		{pattern: `\\*`, meta: true},
+	} {
+		assert.Equal(i.meta, hasGlobMeta(i.pattern), "pattern %q should be detected", i.pattern)
+	}
+}
+
+// globArgs runs the script in a shell with a builtin which records its args
+func globArgs(script string, env Env) ([]string, error) {
+	var args []string
+	env.Envvar = []string{}
+	env.Builtins = DefaultBuiltins()
+	env.Builtins["args"] = func(ctx context.Context, a []string, env Env) (Status, error) {
+		args = a[1:]
+		return Status{}, nil
+	}
+	if _, err := NewShell(env).Run(context.Background(), script); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+func Test_Env_Glob(t *testing.T) {
+	assert := assert.New(t)
+
+	fsys := fstest.MapFS{
+		"b.go":         {},
+		"a.go":         {},
+		"c.txt":        {},
+		".hidden.go":   {},
+		"dir/x.go":     {},
+		"dir/y.md":     {},
+		"other/z.go":   {},
+		"[lit].txt":    {},
+		"space dir/.k": {},
+	}
+	env := Env{FS: fsys}
+	for _, i := range []struct {
+		pattern string
+		matches []string
+	}{
+		{pattern: "*.go", matches: []string{"a.go", "b.go"}},
+		{pattern: ".*.go", matches: []string{".hidden.go"}},
+		{pattern: "?.txt", matches: []string{"c.txt"}},
+		{pattern: "[ab].go", matches: []string{"a.go", "b.go"}},
+		{pattern: "*/*.go", matches: []string{"dir/x.go", "other/z.go"}},
+		{pattern: "dir/*", matches: []string{"dir/x.go", "dir/y.md"}},
+		{pattern: "*/", matches: []string{"dir/", "other/", "space dir/"}},
+		{pattern: "/dir/?.md", matches: []string{"/dir/y.md"}},
+		{pattern: `\[lit\].*`, matches: []string{"[lit].txt"}},
+		{pattern: "*.rs", matches: []string{}},
+		{pattern: "bogus/*", matches: []string{}},
+	} {
+		matches, err := env.Glob(i.pattern)
+		assert.NoError(err, "glob should not error")
+		assert.Equal(i.matches, matches, "pattern %q should match sorted paths", i.pattern)
+	}
+	for _, i := range []string{"dir", "/dir", "other/../dir/"} {
+		env := Env{FS: fsys, Dir: i}
+		matches, err := env.Glob("*")
+		assert.NoError(err, "glob should not error")
+		assert.Equal([]string{"x.go", "y.md"}, matches, "relative patterns should be matched in dir %q", i)
+		matches, err = env.Glob("/*.go")
+		assert.NoError(err, "glob should not error")
+		assert.Equal([]string{"/a.go", "/b.go"}, matches, "absolute patterns should be matched from the root in dir %q", i)
+	}
+}
+
+func Test_Arg_Fields_Glob(t *testing.T) {
+	assert := assert.New(t)
+
+	fsys := fstest.MapFS{
+		"a.go":     {},
+		"b.go":     {},
+		"dir/c.go": {},
+	}
+	for _, i := range []struct {
+		script string
+		args   []string
+	}{
+		{script: `args *.go`, args: []string{"a.go", "b.go"}},
+		{script: `args x*.go`, args: []string{"x*.go"}},
+		{script: `args "*.go" '*.go' \*.go`, args: []string{"*.go", "*.go", "*.go"}},
+		{script: `args "dir"/*.go`, args: []string{"dir/c.go"}},
+		{script: `args "d"*/*`, args: []string{"dir/c.go"}},
+		{script: `args [ab].go [ab`, args: []string{"a.go", "b.go", "[ab"}},
+		{script: `P='*.go'; args $P "$P"`, args: []string{"a.go", "b.go", "*.go"}},
+		{script: `P='a.go b*'; args $P`, args: []string{"a.go", "b.go"}},
+		{script: `P='[ab]'; args ${P}.go`, args: []string{"a.go", "b.go"}},
+		{script: `args ${X:-*}`, args: []string{"a.go", "b.go", "dir"}},
+		{script: `args "$(echo '*.go')"`, args: []string{"*.go"}},
+	} {
+		args, err := globArgs(i.script, Env{FS: fsys})
+		assert.NoError(err, "script %q should not error", i.script)
+		assert.Equal(i.args, args, "script %q should expand globs", i.script)
+	}
+	{
+		args, err := globArgs(`args a.go *.rs b.go`, Env{FS: fsys, Nullglob: true})
+		assert.NoError(err, "script should not error")
+		assert.Equal([]string{"a.go", "b.go"}, args, "nullglob should remove patterns without matches")
+	}
+	{
+		_, err := globArgs(`args *.rs`, Env{FS: fsys, Failglob: true})
+		var globErr *GlobError
+		assert.True(errors.As(err, &globErr), "failglob should error on patterns without matches")
+		assert.Equal("*.rs", globErr.Pattern, "glob error should contain the pattern")
+	}
+	{
+		args, err := globArgs(`[ -n "x" ] && args [ab].go`, Env{FS: fsys, Failglob: true})
+		assert.NoError(err, "test builtin should not be a pattern")
+		assert.Equal([]string{"a.go", "b.go"}, args, "patterns should be expanded after a test")
+	}
+}
+
+func Test_Arg_Fields_GlobDir(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "one.txt"), nil, 0o644), "write should not error")
+	assert.NoError(os.WriteFile(filepath.Join(dir, "two.txt"), nil, 0o644), "write should not error")
+	assert.NoError(os.Mkdir(filepath.Join(dir, "sub"), 0o755), "mkdir should not error")
+	assert.NoError(os.WriteFile(filepath.Join(dir, "sub", "three.txt"), nil, 0o644), "write should not error")
+
+	{
+		args, err := globArgs(`args *.txt */*.txt`, Env{Dir: dir})
+		assert.NoError(err, "script should not error")
+		assert.Equal([]string{"one.txt", "two.txt", "sub/three.txt"}, args, "patterns should be resolved against the working directory")
+	}
+	{
+		args, err := globArgs(`args `+quoteStrL(dir)+`/t*`, Env{})
+		assert.NoError(err, "script should not error")
+		assert.Equal([]string{filepath.Join(dir, "two.txt")}, args, "absolute patterns should match absolute paths")
+	}
+	{
+		args, err := globArgs(`cd sub; args *`, Env{Dir: dir})
+		assert.NoError(err, "script should not error")
+		assert.Equal([]string{"three.txt"}, args, "patterns should be resolved against the directory of the shell")
+	}
+}
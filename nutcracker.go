@@ -1,41 +1,440 @@
 package nutcracker
 
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// AndOr operators
+const (
+	OpAnd = iota
+	OpOr
+)
+
 type (
+	// Cmd is a simple command
 	Cmd struct {
-		args []Node
+		span
+		Assigns []*Assign
+		Args    []*Arg
+		Redirs  []*Redirect
+	}
+
+	// Pipeline is a sequence of commands connected by pipes
+	Pipeline struct {
+		span
+		Cmds []*Cmd
+	}
+
+	// AndOr is a sequence of pipelines connected by && or ||, where Ops[i] is
+	// OpAnd or OpOr and connects Pipes[i] and Pipes[i+1]
+	AndOr struct {
+		span
+		Pipes []*Pipeline
+		Ops   []int
+	}
+
+	// Script is a sequence of command lists
+	Script struct {
+		span
+		Lists []*AndOr
 	}
 )
 
-func Parse(shellcmd string) (*Cmd, error) {
-	args := []Node{}
-	text := trimLSpace(shellcmd)
+// Parse parses a shell script. A *ParseError is returned if shellcmd could
+// not be parsed.
+func Parse(shellcmd string) (*Script, error) {
+	s, _, err := newParser(shellcmd).parseScript(shellcmd, argModeNorm)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newCmd(args []*Arg, redirs []*Redirect) *Cmd {
+	return &Cmd{
+		Assigns: []*Assign{},
+		Args:    args,
+		Redirs:  redirs,
+	}
+}
+
+func (c Cmd) empty() bool {
+	return len(c.Assigns) == 0 && len(c.Args) == 0 && len(c.Redirs) == 0
+}
+
+// Exec calls ExecContext with a background context
+func (c Cmd) Exec(env Env) (Status, error) {
+	return c.ExecContext(context.Background(), env)
+}
+
+// ExecContext runs the command and returns its exit status. An error is
+// returned only if the command could not be run, including if ctx is done
+// before the command is started. If the command has no args after expansion,
+// its assignments are set in env.Vars, and its status is that of its last
+// command substitution. Builtins in env.Builtins are run in place of the
+// executor.
+func (c Cmd) ExecContext(ctx context.Context, env Env) (_ Status, retErr error) {
+	if c.empty() {
+		return Status{}, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return Status{}, err
+	}
+	env.cmdStatus = &Status{}
+	assigns, err := assignValues(ctx, env, c.Assigns)
+	if err != nil {
+		return Status{}, err
+	}
+	k := make([]string, 0, len(c.Args))
+	for _, i := range c.Args {
+		v, err := i.Fields(ctx, env)
+		if err != nil {
+			return Status{}, err
+		}
+		k = append(k, v...)
+	}
+	files := []*os.File{}
+	defer func() {
+		for _, i := range files {
+			if err := i.Close(); err != nil && retErr == nil {
+				retErr = err
+			}
+		}
+	}()
+	for _, i := range c.Redirs {
+		if err := i.apply(ctx, &env, &files); err != nil {
+			return Status{}, err
+		}
+	}
+	if len(k) == 0 {
+		setVars(env, c.Assigns, assigns)
+		return *env.cmdStatus, nil
+	}
+	env = env.cmdEnv()
+	if len(assigns) > 0 {
+		env = withEnvvar(env, assigns)
+	}
+	if f, ok := env.Builtins[k[0]]; ok {
+		return f(ctx, k, env)
+	}
+	return env.Ex.Exec(ctx, k, env)
+}
+
+// parseSimpleCmd parses the assignments, arguments, and redirects of a single
+// command up to the end of the text, an operator, or a newline. Assignments
+// are recognized only before the first argument.
+// takes in a string not beginning with whitespace
+func (p *parser) parseSimpleCmd(text string, mode int) (*Cmd, string, error) {
+	start := p.pos(text)
+	end := start
+	assigns := []*Assign{}
+	args := []*Arg{}
+	redirs := []*Redirect{}
 	for len(text) > 0 {
-		n, next, err := parseArg(text, argModeNorm)
+		ch := text[0]
+		if ch == ')' && mode == argModeCmd {
+			break
+		}
+		r, next, err := p.parseRedirect(text, mode)
 		if err != nil {
-			return nil, err
+			return nil, "", err
+		}
+		if r != nil {
+			redirs = append(redirs, r)
+			text = next
+			end = r.End()
+			continue
+		}
+		if isOperator(ch) || isNewline(ch) {
+			break
+		}
+		if len(args) == 0 {
+			a, next, err := p.parseAssign(text, mode)
+			if err != nil {
+				return nil, "", err
+			}
+			if a != nil {
+				assigns = append(assigns, a)
+				text = next
+				end = a.End()
+				continue
+			}
+		}
+		n, next, err := p.parseArg(text, mode)
+		if err != nil {
+			return nil, "", err
 		}
 		args = append(args, n)
 		text = next
+		end = n.End()
+	}
+	c := newCmd(args, redirs)
+	c.Assigns = assigns
+	c.setSpan(start, end)
+	return c, text, nil
+}
+
+func newPipeline(cmds []*Cmd) *Pipeline {
+	return &Pipeline{
+		Cmds: cmds,
+	}
+}
+
+// Exec calls ExecContext with a background context
+func (p Pipeline) Exec(env Env) (Status, error) {
+	return p.ExecContext(context.Background(), env)
+}
+
+// ExecContext runs each command of the pipeline concurrently with the stdout of
+// each command connected to the stdin of the next. The status of the last
+// command is returned, or if env.Pipefail is set, the status of the last
+// command to exit with a non-zero status.
+func (p Pipeline) ExecContext(ctx context.Context, env Env) (Status, error) {
+	if len(p.Cmds) == 0 {
+		return Status{}, nil
+	}
+	if len(p.Cmds) == 1 {
+		return p.Cmds[0].ExecContext(ctx, env)
+	}
+
+	statuses := make([]Status, len(p.Cmds))
+	errs := make([]error, len(p.Cmds))
+	wg := sync.WaitGroup{}
+	var stdin io.Reader = env.Stdin
+	var prev *os.File
+	var pipeErr error
+	for n, i := range p.Cmds {
+		// each command of a pipeline runs in a subshell
+		e := env.subshell()
+		e.Stdin = stdin
+		var r, w *os.File
+		if n < len(p.Cmds)-1 {
+			r, w, pipeErr = os.Pipe()
+			if pipeErr != nil {
+				break
+			}
+			e.Stdout = w
+			stdin = r
+		}
+		wg.Add(1)
+		go func(n int, c *Cmd, e Env, r, w *os.File) {
+			defer wg.Done()
+			statuses[n], errs[n] = c.ExecContext(ctx, e)
+			// exit only exits the subshell of the command
+			if k, ok := errs[n].(*shellExit); ok {
+				statuses[n], errs[n] = k.status, nil
+			}
+			// closing the write end signals EOF to the next command, and
+			// closing the read end signals a broken pipe to the previous one
+			if w != nil {
+				w.Close()
+			}
+			if r != nil {
+				r.Close()
+			}
+		}(n, i, e, prev, w)
+		prev = r
+	}
+	if pipeErr != nil && prev != nil {
+		prev.Close()
+	}
+	wg.Wait()
+	if pipeErr != nil {
+		return Status{}, pipeErr
+	}
+	for i := len(errs) - 1; i >= 0; i-- {
+		if errs[i] != nil {
+			return Status{}, errs[i]
+		}
+	}
+
+	if env.Pipefail {
+		for i := len(statuses) - 1; i >= 0; i-- {
+			if !statuses[i].Success() {
+				return statuses[i], nil
+			}
+		}
+		return Status{}, nil
+	}
+	return statuses[len(statuses)-1], nil
+}
+
+// parsePipeline parses commands separated by pipes.
+// takes in a string not beginning with whitespace
+func (p *parser) parsePipeline(text string, mode int) (*Pipeline, string, error) {
+	start := p.pos(text)
+	cmds := []*Cmd{}
+	pipe := text
+	for {
+		c, next, err := p.parseSimpleCmd(text, mode)
+		if err != nil {
+			return nil, "", err
+		}
+		text = next
+		if !strings.HasPrefix(text, "|") || strings.HasPrefix(text, "||") {
+			if c.empty() {
+				if len(cmds) > 0 {
+					return nil, "", p.err(pipe, ErrInvalidPipe)
+				}
+				k := newPipeline(cmds)
+				k.setSpan(start, start)
+				return k, text, nil
+			}
+			cmds = append(cmds, c)
+			k := newPipeline(cmds)
+			k.setSpan(start, c.End())
+			return k, text, nil
+		}
+		if c.empty() {
+			return nil, "", p.err(text, ErrInvalidPipe)
+		}
+		cmds = append(cmds, c)
+		pipe = text
+		text = trimLSpace(text[1:])
 	}
-	return &Cmd{
-		args: args,
-	}, nil
 }
 
-func (c Cmd) Exec(env Env) error {
-	if len(c.args) == 0 {
-		return nil
+func newAndOr(pipes []*Pipeline, ops []int) *AndOr {
+	return &AndOr{
+		Pipes: pipes,
+		Ops:   ops,
+	}
+}
+
+// Exec calls ExecContext with a background context
+func (a AndOr) Exec(env Env) (Status, error) {
+	return a.ExecContext(context.Background(), env)
+}
+
+// ExecContext runs the first pipeline, and then runs each following pipeline only if
+// the previous one succeeded for && or failed for ||. The status of the last
+// pipeline to run is returned.
+func (a AndOr) ExecContext(ctx context.Context, env Env) (Status, error) {
+	if len(a.Pipes) == 0 {
+		return Status{}, nil
+	}
+	env = env.withStatus()
+	status, err := a.Pipes[0].ExecContext(ctx, env)
+	if err != nil {
+		return Status{}, err
+	}
+	env.setStatus(status)
+	for n, i := range a.Ops {
+		if (i == OpAnd) == status.Success() {
+			status, err = a.Pipes[n+1].ExecContext(ctx, env)
+			if err != nil {
+				return Status{}, err
+			}
+			env.setStatus(status)
+		}
 	}
-	k := make([]string, 0, len(c.args))
-	for _, i := range c.args {
-		v, err := i.Value(env)
+	return status, nil
+}
+
+// parseAndOr parses pipelines separated by && or ||.
+// takes in a string not beginning with whitespace
+func (p *parser) parseAndOr(text string, mode int) (*AndOr, string, error) {
+	start := p.pos(text)
+	pipes := []*Pipeline{}
+	ops := []int{}
+	op := text
+	for {
+		pipe, next, err := p.parsePipeline(text, mode)
 		if err != nil {
-			return err
+			return nil, "", err
+		}
+		text = next
+		if len(pipe.Cmds) == 0 {
+			if len(pipes) > 0 {
+				return nil, "", p.err(op, ErrInvalidOperator)
+			}
+			a := newAndOr(pipes, ops)
+			a.setSpan(start, start)
+			return a, text, nil
 		}
-		k = append(k, v)
+		pipes = append(pipes, pipe)
+		if strings.HasPrefix(text, "&&") {
+			ops = append(ops, OpAnd)
+		} else if strings.HasPrefix(text, "||") {
+			ops = append(ops, OpOr)
+		} else {
+			a := newAndOr(pipes, ops)
+			a.setSpan(start, pipe.End())
+			return a, text, nil
+		}
+		op = text
+		text = trimLSpace(text[2:])
+	}
+}
+
+func newScript(lists []*AndOr) *Script {
+	return &Script{
+		Lists: lists,
+	}
+}
+
+// Exec calls ExecContext with a background context
+func (s Script) Exec(env Env) (Status, error) {
+	return s.ExecContext(context.Background(), env)
+}
+
+// ExecContext runs each command list of the script in order. A command
+// exiting with a non-zero status does not stop the script, and the status of
+// the last command list is returned. The exit builtin stops the script with
+// its status. If env.Vars is nil, variables assigned by the script are set in
+// a new map for the duration of the script.
+func (s Script) ExecContext(ctx context.Context, env Env) (Status, error) {
+	if env.Vars == nil {
+		env.Vars = map[string]string{}
 	}
-	if err := env.Ex.Exec(k, env); err != nil {
-		return err
+	env = env.withStatus()
+	status := Status{}
+	for _, i := range s.Lists {
+		var err error
+		status, err = i.ExecContext(ctx, env)
+		if err != nil {
+			if k, ok := err.(*shellExit); ok {
+				env.setStatus(k.status)
+				return k.status, nil
+			}
+			return Status{}, err
+		}
+	}
+	return status, nil
+}
+
+// parseScript parses command lists separated by ';' or newlines.
+func (p *parser) parseScript(text string, mode int) (*Script, string, error) {
+	start := p.pos(text)
+	lists := []*AndOr{}
+	for {
+		text = trimLSpace(text)
+		if len(text) == 0 || text[0] == ')' && mode == argModeCmd {
+			s := newScript(lists)
+			s.setSpan(start, p.pos(text))
+			return s, text, nil
+		}
+		a, next, err := p.parseAndOr(text, mode)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(a.Pipes) == 0 {
+			return nil, "", p.err(text, ErrInvalidOperator)
+		}
+		lists = append(lists, a)
+		text = next
+		if len(text) == 0 {
+			continue
+		}
+		ch := text[0]
+		if ch == ';' || isNewline(ch) {
+			text = text[1:]
+		} else if ch != ')' || mode != argModeCmd {
+			return nil, "", p.err(text, ErrInvalidOperator)
+		}
 	}
-	return nil
 }
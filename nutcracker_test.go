@@ -2,8 +2,13 @@ package nutcracker
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func Test_Parse(t *testing.T) {
@@ -15,8 +20,8 @@ func Test_Parse(t *testing.T) {
 		arg := `echo $hello`
 		n, err := Parse(arg)
 		assert.NoError(err, "Parse should not error")
-		assert.Equal([]Node{newNodeArg([]Node{newNodeText("echo")}), newNodeArg([]Node{newNodeEnvVar("hello", nil)})}, n.args, "all arguments should be parsed")
-		err = n.Exec(Env{Envfunc: func(s string) string {
+		assert.Equal([]*Arg{newArg([]Node{newText("echo")}), newArg([]Node{newEnvVar("hello", nil)})}, stripSpan(n.Lists[0].Pipes[0].Cmds[0].Args), "all arguments should be parsed")
+		_, err = n.Exec(Env{Envfunc: func(s string) string {
 			if s == "hello" {
 				return "world"
 			}
@@ -28,13 +33,13 @@ func Test_Parse(t *testing.T) {
 	{
 		arg := `echo $hello\`
 		_, err := Parse(arg)
-		assert.Equal(ErrInvalidEscape, err, "Parse should error on invalid argument")
+		assert.True(errors.Is(err, ErrInvalidEscape), "Parse should error on invalid argument")
 	}
 	{
 		arg := `echo $(bogus)`
 		n, err := Parse(arg)
 		assert.NoError(err, "Parse should not error for valid syntax")
-		err = n.Exec(Env{Ex: exec})
+		_, err = n.Exec(Env{Ex: exec})
 		assert.Error(err, "Parse should error on command error")
 	}
 	{
@@ -42,7 +47,7 @@ func Test_Parse(t *testing.T) {
 		arg := ``
 		n, err := Parse(arg)
 		assert.NoError(err, "Parse should not error for valid syntax")
-		err = n.Exec(Env{Ex: exec, Stdout: &b})
+		_, err = n.Exec(Env{Ex: exec, Stdout: &b})
 		assert.NoError(err, "Exec should not error on empty command")
 		assert.Equal("", b.String(), "Exec should not write to stdout on empty command")
 	}
@@ -50,7 +55,325 @@ func Test_Parse(t *testing.T) {
 		arg := `bogus hello`
 		n, err := Parse(arg)
 		assert.NoError(err, "Parse should not error for valid syntax")
-		err = n.Exec(Env{Ex: exec})
+		_, err = n.Exec(Env{Ex: exec})
 		assert.Error(err, "Parse should error on command error")
 	}
 }
+
+func Test_Pipeline(t *testing.T) {
+	assert := assert.New(t)
+
+	exec := NewExecutor()
+	{
+		b := bytes.Buffer{}
+		arg := `echo hello world | tr a-z A-Z|tr -d O`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		assert.Equal([]*Cmd{
+			newCmd([]*Arg{newArg([]Node{newText("echo")}), newArg([]Node{newText("hello")}), newArg([]Node{newText("world")})}, []*Redirect{}),
+			newCmd([]*Arg{newArg([]Node{newText("tr")}), newArg([]Node{newText("a-z")}), newArg([]Node{newText("A-Z")})}, []*Redirect{}),
+			newCmd([]*Arg{newArg([]Node{newText("tr")}), newArg([]Node{newText("-d")}), newArg([]Node{newText("O")})}, []*Redirect{}),
+		}, stripSpan(n.Lists[0].Pipes[0].Cmds), "all commands should be parsed")
+		_, err = n.Exec(Env{Ex: exec, Stdout: &b})
+		assert.NoError(err, "pipeline should not error")
+		assert.Equal("HELL WRLD\n", b.String(), "pipeline output should be correct")
+	}
+	{
+		b := bytes.Buffer{}
+		arg := `echo "a|b" 'c|d' e\|f | cat`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		assert.Equal(2, len(n.Lists[0].Pipes[0].Cmds), "quoted pipes should not split commands")
+		_, err = n.Exec(Env{Ex: exec, Stdout: &b})
+		assert.NoError(err, "pipeline should not error")
+		assert.Equal("a|b c|d e|f\n", b.String(), "quoted pipes should be literal")
+	}
+	{
+		b := bytes.Buffer{}
+		arg := `yes | head -n 2`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Ex: exec, Stdout: &b})
+		assert.NoError(err, "pipeline should finish when a later command exits early")
+		assert.Equal("y\ny\n", b.String(), "pipeline output should be correct")
+	}
+	{
+		arg := `false | true`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		status, err := n.Exec(Env{Ex: exec})
+		assert.NoError(err, "pipeline should not error")
+		assert.True(status.Success(), "pipeline should return the status of the last command")
+		status, err = n.Exec(Env{Ex: exec, Pipefail: true})
+		assert.NoError(err, "pipeline should not error")
+		assert.Equal(Status{Code: 1}, status, "pipefail should return the status of any failed command")
+	}
+	{
+		arg := `true | false`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		status, err := n.Exec(Env{Ex: exec})
+		assert.NoError(err, "pipeline should not error")
+		assert.Equal(Status{Code: 1}, status, "pipeline should return the status of the last command")
+	}
+	{
+		b := bytes.Buffer{}
+		arg := `echo $(echo hello | tr a-z A-Z)`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Ex: exec, Stdout: &b})
+		assert.NoError(err, "pipeline in command substitution should not error")
+		assert.Equal("HELLO\n", b.String(), "pipeline in command substitution should be correct")
+	}
+	{
+		_, err := Parse(`| echo hello`)
+		assert.True(errors.Is(err, ErrInvalidPipe), "Parse should error on missing command")
+	}
+	{
+		_, err := Parse(`echo hello |`)
+		assert.True(errors.Is(err, ErrInvalidPipe), "Parse should error on missing command")
+	}
+	{
+		_, err := Parse(`echo hello | | cat`)
+		assert.True(errors.Is(err, ErrInvalidPipe), "Parse should error on missing command")
+	}
+	{
+		_, err := Parse(`echo $(echo hello |)`)
+		assert.True(errors.Is(err, ErrInvalidPipe), "Parse should error on missing command in command substitution")
+	}
+}
+
+func Test_Script(t *testing.T) {
+	assert := assert.New(t)
+
+	exec := NewExecutor()
+	{
+		b := bytes.Buffer{}
+		arg := `false && echo hello || echo failed; echo done`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		assert.Equal(newScript([]*AndOr{
+			newAndOr([]*Pipeline{
+				newPipeline([]*Cmd{newCmd([]*Arg{newArg([]Node{newText("false")})}, []*Redirect{})}),
+				newPipeline([]*Cmd{newCmd([]*Arg{newArg([]Node{newText("echo")}), newArg([]Node{newText("hello")})}, []*Redirect{})}),
+				newPipeline([]*Cmd{newCmd([]*Arg{newArg([]Node{newText("echo")}), newArg([]Node{newText("failed")})}, []*Redirect{})}),
+			}, []int{OpAnd, OpOr}),
+			newAndOr([]*Pipeline{
+				newPipeline([]*Cmd{newCmd([]*Arg{newArg([]Node{newText("echo")}), newArg([]Node{newText("done")})}, []*Redirect{})}),
+			}, []int{}),
+		}), stripSpan(n), "all command lists should be parsed")
+		_, err = n.Exec(Env{Ex: exec, Stdout: &b})
+		assert.NoError(err, "script should not error")
+		assert.Equal("failed\ndone\n", b.String(), "lists should short circuit")
+	}
+	{
+		b := bytes.Buffer{}
+		arg := `true && echo hello || echo failed
+echo a;echo b;
+true &&
+	echo c`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		assert.Equal(4, len(n.Lists), "newlines should separate command lists")
+		_, err = n.Exec(Env{Ex: exec, Stdout: &b})
+		assert.NoError(err, "script should not error")
+		assert.Equal("hello\na\nb\nc\n", b.String(), "lists should short circuit")
+	}
+	{
+		b := bytes.Buffer{}
+		arg := `echo hello; false`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		status, err := n.Exec(Env{Ex: exec, Stdout: &b})
+		assert.NoError(err, "script should not error")
+		assert.Equal(Status{Code: 1}, status, "script should return the status of the last command")
+		assert.Equal("hello\n", b.String(), "script output should be correct")
+	}
+	{
+		b := bytes.Buffer{}
+		arg := `false; echo hello`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Ex: exec, Stdout: &b})
+		assert.NoError(err, "script should continue after a failed command")
+		assert.Equal("hello\n", b.String(), "script output should be correct")
+	}
+	{
+		b := bytes.Buffer{}
+		arg := `echo "a;b" 'c&&d' e\;f\|\|g`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Ex: exec, Stdout: &b})
+		assert.NoError(err, "script should not error")
+		assert.Equal("a;b c&&d e;f||g\n", b.String(), "quoted operators should be literal")
+	}
+	{
+		b := bytes.Buffer{}
+		arg := `echo $(echo a; false || echo b)`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Ex: exec, Stdout: &b})
+		assert.NoError(err, "script should not error")
+		assert.Equal("a b\n", b.String(), "lists in command substitution should be run")
+	}
+	{
+		arg := `echo hello || bogus && echo world`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Ex: exec})
+		assert.NoError(err, "skipped commands should not be run")
+	}
+	{
+		arg := `bogus || echo world`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Ex: exec})
+		assert.Error(err, "script should error on commands that cannot be run")
+	}
+	{
+		arg := `bogus; echo world`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Ex: exec})
+		assert.Error(err, "script should stop on commands that cannot be run")
+	}
+	{
+		b := bytes.Buffer{}
+		arg := `printf '<%s>' $(echo a b) "$(echo c d)"`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Ex: exec, Stdout: &b})
+		assert.NoError(err, "script should not error")
+		assert.Equal("<a><b><c d>", b.String(), "unquoted command substitutions should be split into args")
+	}
+	{
+		_, err := Parse(`echo hello &&`)
+		assert.True(errors.Is(err, ErrInvalidOperator), "Parse should error on missing command")
+	}
+	{
+		_, err := Parse(`|| echo hello`)
+		assert.True(errors.Is(err, ErrInvalidOperator), "Parse should error on missing command")
+	}
+	{
+		_, err := Parse(`echo hello;; echo world`)
+		assert.True(errors.Is(err, ErrInvalidOperator), "Parse should error on empty command list")
+	}
+	{
+		_, err := Parse(`echo hello && || echo world`)
+		assert.True(errors.Is(err, ErrInvalidOperator), "Parse should error on missing command")
+	}
+}
+
+func Test_Script_ExecContext(t *testing.T) {
+	assert := assert.New(t)
+
+	exec := NewExecutor()
+	{
+		arg := `echo $(sleep 10)`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = n.ExecContext(ctx, Env{Ex: exec})
+		assert.Equal(&ExitError{Status: Status{Code: 128 + 9, Signal: syscall.SIGKILL, Canceled: true}}, err, "command substitution should be canceled")
+	}
+	{
+		arg := `sleep 10; echo hello`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = n.ExecContext(ctx, Env{Ex: exec})
+		assert.Equal(context.DeadlineExceeded, err, "script should stop once the context is done")
+	}
+	{
+		arg := `echo hello`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = n.ExecContext(ctx, Env{Ex: exec})
+		assert.Equal(context.Canceled, err, "command should not be started once the context is done")
+	}
+}
+
+// stripSpan zeros the positions of all nodes of v, such that parsed nodes may
+// be compared to nodes created by their constructors
+func stripSpan(v interface{}) interface{} {
+	switch k := v.(type) {
+	case Syntax:
+		Inspect(k, func(n Syntax) bool {
+			if k, ok := n.(interface{ setSpan(start, end Pos) }); ok {
+				k.setSpan(Pos{}, Pos{})
+			}
+			return true
+		})
+	case []*Cmd:
+		for _, i := range k {
+			stripSpan(i)
+		}
+	case []*Assign:
+		for _, i := range k {
+			stripSpan(i)
+		}
+	case []*Arg:
+		for _, i := range k {
+			stripSpan(i)
+		}
+	}
+	return v
+}
+
+func Test_Parse_ParseError(t *testing.T) {
+	assert := assert.New(t)
+
+	{
+		arg := "echo hello\necho \"world $(cat)"
+		_, err := Parse(arg)
+		assert.Equal(&ParseError{Pos: Pos{Offset: 16, Line: 2, Col: 6}, Snippet: `"world $(cat)`, Err: ErrUnclosedStrI}, err, "parse error should be located at the opening quote")
+		assert.True(errors.Is(err, ErrUnclosedStrI), "parse error should match its cause")
+	}
+	{
+		arg := "echo hello |\n\t| cat"
+		_, err := Parse(arg)
+		assert.Equal(&ParseError{Pos: Pos{Offset: 14, Line: 2, Col: 2}, Snippet: `| cat`, Err: ErrInvalidPipe}, err, "parse error should be located at the pipe")
+	}
+	{
+		arg := `echo ${hello:-$(cat ${world)}`
+		_, err := Parse(arg)
+		assert.Equal(&ParseError{Pos: Pos{Offset: 20, Line: 1, Col: 21}, Snippet: `${world)}`, Err: ErrInvalidVar}, err, "parse error should be located at the nested variable")
+	}
+	{
+		arg := "echo '" + strings.Repeat("a", 64)
+		_, err := Parse(arg)
+		assert.Equal(&ParseError{Pos: Pos{Offset: 5, Line: 1, Col: 6}, Snippet: "'" + strings.Repeat("a", 31), Err: ErrUnclosedStrL}, err, "parse error snippet should be truncated")
+	}
+}
+
+func Test_Parse_Pos(t *testing.T) {
+	assert := assert.New(t)
+
+	arg := "echo \"a $b\" > out\n  cat|wc"
+	n, err := Parse(arg)
+	assert.NoError(err, "Parse should not error")
+	assert.Equal(Pos{Offset: 0, Line: 1, Col: 1}, n.Pos(), "script should begin at the start of the text")
+	assert.Equal(Pos{Offset: 26, Line: 2, Col: 9}, n.End(), "script should end at the end of the text")
+
+	echo := n.Lists[0].Pipes[0].Cmds[0]
+	assert.Equal(Pos{Offset: 0, Line: 1, Col: 1}, echo.Pos(), "command should begin at its first argument")
+	assert.Equal(Pos{Offset: 17, Line: 1, Col: 18}, echo.End(), "command should end after its last Redirect")
+	str := echo.Args[1].Nodes[0]
+	assert.Equal(Pos{Offset: 5, Line: 1, Col: 6}, str.Pos(), "string should begin at the opening quote")
+	assert.Equal(Pos{Offset: 11, Line: 1, Col: 12}, str.End(), "string should end after the closing quote")
+	v := str.(*StrI).Nodes[1]
+	assert.Equal(Pos{Offset: 8, Line: 1, Col: 9}, v.Pos(), "variable should begin at the dollar sign")
+	assert.Equal(Pos{Offset: 10, Line: 1, Col: 11}, v.End(), "variable should end after its name")
+	r := echo.Redirs[0]
+	assert.Equal(Pos{Offset: 12, Line: 1, Col: 13}, r.Pos(), "Redirect should begin at the operator")
+	assert.Equal(Pos{Offset: 17, Line: 1, Col: 18}, r.End(), "Redirect should end after its target")
+
+	pipe := n.Lists[1].Pipes[0]
+	assert.Equal(Pos{Offset: 20, Line: 2, Col: 3}, pipe.Pos(), "pipeline should begin at its first command")
+	assert.Equal(Pos{Offset: 26, Line: 2, Col: 9}, pipe.End(), "pipeline should end after its last command")
+	assert.Equal(Pos{Offset: 24, Line: 2, Col: 7}, pipe.Cmds[1].Pos(), "pipeline command should begin after the pipe")
+}
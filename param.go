@@ -0,0 +1,287 @@
+package nutcracker
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type (
+	// VarAssign is a ${name:=word} parameter expansion which assigns word to
+	// the variable in env.Vars when it is unset or empty, or only when it is
+	// unset if Unset is true, and evaluates to the value of the variable
+	VarAssign struct {
+		span
+		Name  string
+		Word  []*Arg
+		Unset bool
+	}
+
+	// VarCheck is a ${name:?word} parameter expansion which returns a
+	// *ParamError with the message word when the variable is unset or empty,
+	// or only when it is unset if Unset is true
+	VarCheck struct {
+		span
+		Name  string
+		Word  []*Arg
+		Unset bool
+	}
+
+	// VarAlt is a ${name:+word} parameter expansion which evaluates to word
+	// when the variable is set and non-empty, or only set if Unset is true,
+	// and to the empty string otherwise
+	VarAlt struct {
+		span
+		Name  string
+		Word  []*Arg
+		Unset bool
+	}
+
+	// VarLen is a ${#name} parameter expansion which evaluates to the number
+	// of characters in the value of the variable
+	VarLen struct {
+		span
+		Name string
+	}
+
+	// VarTrimPrefix is a ${name#pattern} parameter expansion which evaluates
+	// to the value of the variable with the shortest prefix matching Pattern
+	// removed, or the longest if Longest is true
+	VarTrimPrefix struct {
+		span
+		Name    string
+		Pattern []*Arg
+		Longest bool
+	}
+
+	// VarTrimSuffix is a ${name%pattern} parameter expansion which evaluates
+	// to the value of the variable with the shortest suffix matching Pattern
+	// removed, or the longest if Longest is true
+	VarTrimSuffix struct {
+		span
+		Name    string
+		Pattern []*Arg
+		Longest bool
+	}
+)
+
+// isSetVar reports whether a variable counts as set for a parameter
+// expansion, which requires a non-empty value unless unset is true
+func isSetVar(v string, ok bool, unset bool) bool {
+	return ok && (unset || len(v) > 0)
+}
+
+func newVarAssign(name string, word []*Arg, unset bool) *VarAssign {
+	return &VarAssign{
+		Name:  name,
+		Word:  word,
+		Unset: unset,
+	}
+}
+
+func (n VarAssign) Value(ctx context.Context, env Env) (string, error) {
+	v, ok := env.LookupVar(n.Name)
+	if isSetVar(v, ok, n.Unset) {
+		return v, nil
+	}
+	v, err := wordValue(ctx, env, n.Word)
+	if err != nil {
+		return "", err
+	}
+	if env.Vars != nil {
+		env.Vars[n.Name] = v
+	}
+	return v, nil
+}
+
+func newVarCheck(name string, word []*Arg, unset bool) *VarCheck {
+	return &VarCheck{
+		Name:  name,
+		Word:  word,
+		Unset: unset,
+	}
+}
+
+func (n VarCheck) Value(ctx context.Context, env Env) (string, error) {
+	v, ok := env.LookupVar(n.Name)
+	if isSetVar(v, ok, n.Unset) {
+		return v, nil
+	}
+	msg, err := wordValue(ctx, env, n.Word)
+	if err != nil {
+		return "", err
+	}
+	return "", &ParamError{
+		Pos:     n.Pos(),
+		Name:    n.Name,
+		Message: msg,
+	}
+}
+
+func newVarAlt(name string, word []*Arg, unset bool) *VarAlt {
+	return &VarAlt{
+		Name:  name,
+		Word:  word,
+		Unset: unset,
+	}
+}
+
+func (n VarAlt) Value(ctx context.Context, env Env) (string, error) {
+	v, ok := env.LookupVar(n.Name)
+	if !isSetVar(v, ok, n.Unset) {
+		return "", nil
+	}
+	return wordValue(ctx, env, n.Word)
+}
+
+func newVarLen(name string) *VarLen {
+	return &VarLen{
+		Name: name,
+	}
+}
+
+func (n VarLen) Value(ctx context.Context, env Env) (string, error) {
+	v, err := env.lookupRef(n, n.Name)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(utf8.RuneCountInString(v)), nil
+}
+
+func newVarTrimPrefix(name string, pattern []*Arg, longest bool) *VarTrimPrefix {
+	return &VarTrimPrefix{
+		Name:    name,
+		Pattern: pattern,
+		Longest: longest,
+	}
+}
+
+func (n VarTrimPrefix) Value(ctx context.Context, env Env) (string, error) {
+	v, err := env.lookupRef(n, n.Name)
+	if err != nil {
+		return "", err
+	}
+	pattern, err := patternValue(ctx, env, n.Pattern)
+	if err != nil {
+		return "", err
+	}
+	return trimPrefixPattern(v, pattern, n.Longest), nil
+}
+
+func newVarTrimSuffix(name string, pattern []*Arg, longest bool) *VarTrimSuffix {
+	return &VarTrimSuffix{
+		Name:    name,
+		Pattern: pattern,
+		Longest: longest,
+	}
+}
+
+func (n VarTrimSuffix) Value(ctx context.Context, env Env) (string, error) {
+	v, err := env.lookupRef(n, n.Name)
+	if err != nil {
+		return "", err
+	}
+	pattern, err := patternValue(ctx, env, n.Pattern)
+	if err != nil {
+		return "", err
+	}
+	return trimSuffixPattern(v, pattern, n.Longest), nil
+}
+
+// patternValue evaluates the pattern of a parameter expansion. Quoted and
+// escaped text is matched literally, while unquoted pattern characters and
+// expansions may contain pattern characters.
+func patternValue(ctx context.Context, env Env, pattern []*Arg) (string, error) {
+	s := strings.Builder{}
+	for n, i := range pattern {
+		if n > 0 {
+			s.WriteByte(' ')
+		}
+		for _, j := range i.Nodes {
+			v, err := j.Value(ctx, env)
+			if err != nil {
+				return "", err
+			}
+			switch k := j.(type) {
+			case *Glob:
+				s.WriteString(k.Pattern)
+			case *Text, *StrL, *StrI, *Tilde:
+				s.WriteString(escapePattern(v))
+			default:
+				s.WriteString(v)
+			}
+		}
+	}
+	return s.String(), nil
+}
+
+// params returns the positional parameters
+func (env Env) params() []string {
+	if len(env.Args) < 2 {
+		return nil
+	}
+	return env.Args[1:]
+}
+
+// lookupParam returns the value of a positional or special parameter. $0 and
+// the positional parameters are Args, and $@ and $* are unset without
+// positional parameters. $? is the status of the last command list.
+func (env Env) lookupParam(name string) (string, bool) {
+	switch name {
+	case "@":
+		return strings.Join(env.params(), " "), len(env.params()) > 0
+	case "*":
+		sep := ""
+		if ifs := env.FieldSeparator(); len(ifs) > 0 {
+			sep = ifs[0:1]
+		}
+		return strings.Join(env.params(), sep), len(env.params()) > 0
+	case "#":
+		return strconv.Itoa(len(env.params())), true
+	case "?":
+		return strconv.Itoa(env.lastStatus().Code), true
+	case "$":
+		return strconv.Itoa(os.Getpid()), true
+	}
+	k, err := strconv.Atoi(name)
+	if err != nil || k >= len(env.Args) {
+		return "", false
+	}
+	return env.Args[k], true
+}
+
+// hasParamsAll reports whether the string contains a "$@" reference
+func (n StrI) hasParamsAll() bool {
+	for _, i := range n.Nodes {
+		if k, ok := i.(*EnvVar); ok && k.Name == "@" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFields writes the string to b, with each positional parameter of a
+// "$@" reference in a separate field, unless the reference evaluates to its
+// default. A string consisting only of "$@" produces no fields if there are
+// no positional parameters.
+func (n StrI) writeFields(ctx context.Context, env Env, b *fieldBuilder) error {
+	for _, i := range n.Nodes {
+		if k, ok := i.(*EnvVar); ok && k.Name == "@" && !k.usesDefault(env) {
+			for m, j := range env.params() {
+				if m > 0 {
+					b.delimit()
+				}
+				b.writeText(j)
+			}
+			continue
+		}
+		v, err := i.Value(ctx, env)
+		if err != nil {
+			return err
+		}
+		b.writeText(v)
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package nutcracker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func Test_parseVarLong(t *testing.T) {
+	assert := assert.New(t)
+
+	{
+		arg := `${a-b c}d`
+		n, next, err := newParser(arg).parseVar(arg)
+		assert.NoError(err, "parse var should not error")
+		assert.Equal("d", next, "only the var should be parsed")
+		k := newEnvVar("a", []*Arg{newArg([]Node{newText("b")}), newArg([]Node{newText("c")})})
+		k.Unset = true
+		assert.Equal(k, stripSpan(n), "default should be parsed")
+	}
+	{
+		arg := `${a:=b}`
+		n, _, err := newParser(arg).parseVar(arg)
+		assert.NoError(err, "parse var should not error")
+		assert.Equal(newVarAssign("a", []*Arg{newArg([]Node{newText("b")})}, false), stripSpan(n), "assign should be parsed")
+	}
+	{
+		arg := `${a?}`
+		n, _, err := newParser(arg).parseVar(arg)
+		assert.NoError(err, "parse var should not error")
+		assert.Equal(newVarCheck("a", []*Arg{}, true), stripSpan(n), "check should be parsed")
+	}
+	{
+		arg := `${a:+"$b"}`
+		n, _, err := newParser(arg).parseVar(arg)
+		assert.NoError(err, "parse var should not error")
+		assert.Equal(newVarAlt("a", []*Arg{newArg([]Node{newStrI([]Node{newEnvVar("b", nil)})})}, false), stripSpan(n), "alt should be parsed")
+	}
+	{
+		arg := `${#a}`
+		n, _, err := newParser(arg).parseVar(arg)
+		assert.NoError(err, "parse var should not error")
+		assert.Equal(newVarLen("a"), stripSpan(n), "length should be parsed")
+	}
+	{
+		arg := `${a##*/}`
+		n, _, err := newParser(arg).parseVar(arg)
+		assert.NoError(err, "parse var should not error")
+		assert.Equal(newVarTrimPrefix("a", []*Arg{newArg([]Node{newGlob("*/")})}, true), stripSpan(n), "trim prefix should be parsed")
+	}
+	{
+		arg := `${a%.*}`
+		n, _, err := newParser(arg).parseVar(arg)
+		assert.NoError(err, "parse var should not error")
+		assert.Equal(newVarTrimSuffix("a", []*Arg{newArg([]Node{newGlob(".*")})}, false), stripSpan(n), "trim suffix should be parsed")
+	}
+	{
+		arg := `${a% b *}`
+		n, _, err := newParser(arg).parseVar(arg)
+		assert.NoError(err, "parse var should not error")
+		assert.Equal(newVarTrimSuffix("a", []*Arg{newArg([]Node{newText(" "), newText("b"), newText(" "), newGlob("*")})}, false), stripSpan(n), "whitespace of a pattern should be parsed")
+	}
+	{
+		arg := `${a/b}`
+		_, _, err := newParser(arg).parseVar(arg)
+		assert.True(errors.Is(err, ErrInvalidVar), "parse var should error on unsupported operators")
+	}
+	{
+		arg := `${}`
+		_, _, err := newParser(arg).parseVar(arg)
+		assert.True(errors.Is(err, ErrInvalidVar), "parse var should error on an empty name")
+	}
+	{
+		arg := `${#a:-b}`
+		_, _, err := newParser(arg).parseVar(arg)
+		assert.True(errors.Is(err, ErrInvalidVar), "parse var should error on operators after length")
+	}
+	{
+		arg := `${a:?b`
+		_, _, err := newParser(arg).parseVar(arg)
+		assert.True(errors.Is(err, ErrUnclosedBrace), "parse var should error on unclosed brace")
+	}
+}
+
+func Test_ParamExpansion_Value(t *testing.T) {
+	assert := assert.New(t)
+
+	envfunc := func(s string) string {
+		switch s {
+		case "path":
+			return "/usr/lib/file.tar.gz"
+		case "name":
+			return "héllo"
+		}
+		return ""
+	}
+	for _, i := range []struct {
+		arg   string
+		value string
+	}{
+		{`${path-def}`, "/usr/lib/file.tar.gz"},
+		{`${empty-def}`, ""},
+		{`${unset-def}`, "def"},
+		{`${empty:-def}`, "def"},
+		{`${path:+alt}`, "alt"},
+		{`${empty+alt}`, "alt"},
+		{`${empty:+alt}`, ""},
+		{`${unset+alt}`, ""},
+		{`${#name}`, "5"},
+		{`${#unset}`, "0"},
+		{`${path#*/}`, "usr/lib/file.tar.gz"},
+		{`${path##*/}`, "file.tar.gz"},
+		{`${path%.*}`, "/usr/lib/file.tar"},
+		{`${path%%.*}`, "/usr/lib/file"},
+		{`${path%'.*'}`, "/usr/lib/file.tar.gz"},
+		{`${path%"."gz}`, "/usr/lib/file.tar"},
+		{`${path##\*}`, "/usr/lib/file.tar.gz"},
+		{`${path#\/usr}`, "/lib/file.tar.gz"},
+		{`${path#$prefix}`, "file.tar.gz"},
+		{`"${words% *}"`, "a b"},
+		{`"${words%% *}"`, "a"},
+		{`"${words#* }"`, "b c"},
+		{`"${words##* }"`, "c"},
+		{`"${words%  c}"`, "a b c"},
+		{`"${words% "c"}"`, "a b"},
+		{`${empty:=assigned}`, "assigned"},
+		{`${empty=assigned}`, ""},
+	} {
+		vars := map[string]string{
+			"empty":  "",
+			"prefix": "/usr/lib/",
+			"words":  "a b c",
+		}
+		n, _, err := newParser(i.arg).parseArg(i.arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		v, err := n.Value(context.Background(), Env{Envfunc: envfunc, Vars: vars})
+		assert.NoError(err, "value should not error")
+		assert.Equal(i.value, v, "value of %s should be evaluated", i.arg)
+	}
+	{
+		vars := map[string]string{}
+		arg := `${a:=b c}${a}`
+		n, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		v, err := n.Value(context.Background(), Env{Vars: vars})
+		assert.NoError(err, "value should not error")
+		assert.Equal("b cb c", v, "assigned value should be used")
+		assert.Equal(map[string]string{"a": "b c"}, vars, "variable should be assigned")
+	}
+	{
+		arg := `x ${config:?missing  config}`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Ex: NewExecutor()})
+		var perr *ParamError
+		assert.True(errors.As(err, &perr), "check should return a param error")
+		assert.Equal(&ParamError{Pos: Pos{Offset: 2, Line: 1, Col: 3}, Name: "config", Message: "missing  config"}, perr, "param error should contain the name, position, and message")
+	}
+	{
+		vars := map[string]string{"config": ""}
+		arg := `${config?missing}`
+		n, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		v, err := n.Value(context.Background(), Env{Vars: vars})
+		assert.NoError(err, "check should not error on empty variables without a colon")
+		assert.Equal("", v, "check should return the value")
+	}
+}
+
+func Test_Params(t *testing.T) {
+	assert := assert.New(t)
+
+	{
+		arg := `$1$10${10}$@$*$#$?$$`
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		assert.Equal("", next, "all params should be parsed")
+		assert.Equal(newArg([]Node{
+			newEnvVar("1", nil),
+			newEnvVar("1", nil),
+			newText("0"),
+			newEnvVar("10", nil),
+			newEnvVar("@", nil),
+			newEnvVar("*", nil),
+			newEnvVar("#", nil),
+			newEnvVar("?", nil),
+			newEnvVar("$", nil),
+		}), stripSpan(n), "params should be parsed")
+	}
+	{
+		arg := `${#} ${#1} ${@:-a} ${1-b}`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		k := newEnvVar("1", []*Arg{newArg([]Node{newText("b")})})
+		k.Unset = true
+		assert.Equal([]*Arg{
+			newArg([]Node{newEnvVar("#", nil)}),
+			newArg([]Node{newVarLen("1")}),
+			newArg([]Node{newEnvVar("@", []*Arg{newArg([]Node{newText("a")})})}),
+			newArg([]Node{k}),
+		}, stripSpan(n.Lists[0].Pipes[0].Cmds[0].Args), "params should be parsed in braces")
+	}
+
+	args := []string{"recipe", "a b", "", "c", "4", "5", "6", "7", "8", "9", "ten"}
+	for _, i := range []struct {
+		arg    string
+		fields []string
+	}{
+		{`$0`, []string{"recipe"}},
+		{`$1`, []string{"a", "b"}},
+		{`"$1"`, []string{"a b"}},
+		{`${10}`, []string{"ten"}},
+		{`$10`, []string{"a", "b0"}},
+		{`${11-unset}`, []string{"unset"}},
+		{`${2:-empty}`, []string{"empty"}},
+		{`${#1}`, []string{"3"}},
+		{`$#`, []string{"10"}},
+		{`"$@"`, []string{"a b", "", "c", "4", "5", "6", "7", "8", "9", "ten"}},
+		{`"x$@y"`, []string{"xa b", "", "c", "4", "5", "6", "7", "8", "9", "teny"}},
+		{`$@`, []string{"a", "b", "c", "4", "5", "6", "7", "8", "9", "ten"}},
+		{`"$*"`, []string{"a b  c 4 5 6 7 8 9 ten"}},
+		{`$?`, []string{"0"}},
+	} {
+		n, _, err := newParser(i.arg).parseArg(i.arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		fields, err := n.Fields(context.Background(), Env{Args: args})
+		assert.NoError(err, "node fields should not error")
+		assert.Equal(i.fields, fields, "fields of %s should be expanded", i.arg)
+	}
+	for _, i := range []struct {
+		arg    string
+		fields []string
+	}{
+		{`"${@:-x}"`, []string{"x"}},
+		{`"${@-x}"`, []string{"x"}},
+		{`"a${@:-b c}d"`, []string{"ab cd"}},
+		{`"${*-x}"`, []string{"x"}},
+		{`"$@"`, []string{}},
+		{`$*`, []string{}},
+	} {
+		n, _, err := newParser(i.arg).parseArg(i.arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		fields, err := n.Fields(context.Background(), Env{Args: []string{"recipe"}, Nounset: true})
+		assert.NoError(err, "node fields should not error")
+		assert.Equal(i.fields, fields, "fields of %s should be expanded without positional parameters", i.arg)
+	}
+	{
+		n, _, err := newParser(`"${@:-x}"`).parseArg(`"${@:-x}"`, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		fields, err := n.Fields(context.Background(), Env{Args: []string{"recipe", "a", "b"}})
+		assert.NoError(err, "node fields should not error")
+		assert.Equal([]string{"a", "b"}, fields, "the default of $@ should not be used with positional parameters")
+	}
+	{
+		arg := `"$@" "$*" "a$@"`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		fields := []string{}
+		for _, i := range n.Lists[0].Pipes[0].Cmds[0].Args {
+			k, err := i.Fields(context.Background(), Env{Args: []string{"recipe"}, IFS: ":"})
+			assert.NoError(err, "node fields should not error")
+			fields = append(fields, k...)
+		}
+		assert.Equal([]string{"", "a"}, fields, `"$@" should expand to no fields without positional parameters`)
+	}
+	{
+		n, _, err := newParser(`"$*"`).parseArg(`"$*"`, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		v, err := n.Value(context.Background(), Env{Args: []string{"recipe", "a", "b"}, IFS: ":"})
+		assert.NoError(err, "value should not error")
+		assert.Equal("a:b", v, `"$*" should be joined with the first character of IFS`)
+	}
+	{
+		b := bytes.Buffer{}
+		s := NewShell(Env{Envvar: []string{}, Args: []string{"recipe", "hello world"}, Stdout: &b})
+		_, err := s.Run(context.Background(), `echo "$0" $# "$1"; false; echo $?; echo $?; echo $$`)
+		assert.NoError(err, "Run should not error")
+		assert.Equal(fmt.Sprintf("recipe 1 hello world\n1\n0\n%d\n", os.Getpid()), b.String(), "shell should expand special params")
+	}
+	{
+		b := bytes.Buffer{}
+		n, err := Parse(`false; echo $?; false || echo $?; x=$(exit 4); echo $? | cat; echo $?`)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Envvar: []string{}, Builtins: DefaultBuiltins(), Ex: NewExecutor(), Stdout: &b})
+		assert.NoError(err, "script should not error")
+		assert.Equal("1\n1\n4\n0\n", b.String(), "$? should be the last status without a shell")
+	}
+	{
+		_, _, err := newParser(`$`).parseVar(`$`)
+		assert.True(errors.Is(err, ErrInvalidVar), "parse var should error on missing name")
+	}
+}
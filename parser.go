@@ -2,8 +2,13 @@ package nutcracker
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
+	"io/fs"
+	"sort"
 	"strings"
+	"unicode/utf8"
 )
 
 const (
@@ -11,57 +16,183 @@ const (
 	argModeCmd
 	argModeSub
 	argModeVar
+	argModeBrace
 )
 
 type (
 	EnvFunc func(string) string
 
+	// LookupFunc returns the value of a variable and whether it is set, and is
+	// compatible with os.LookupEnv
+	LookupFunc func(string) (string, bool)
+
 	Env struct {
-		Envvar  []string
-		Envfunc EnvFunc
-		Stdin   io.Reader
-		Stdout  io.Writer
-		Stderr  io.Writer
-		Ex      Executor
+		Envvar      []string
+		Envfunc     EnvFunc
+		Lookup      LookupFunc
+		Stdin       io.Reader
+		Stdout      io.Writer
+		Stderr      io.Writer
+		Ex          Executor
+		Pipefail    bool
+		IFS         string
+		Vars        map[string]string
+		Nounset     bool
+		Dir         string
+		Shell       *Shell
+		Builtins    map[string]BuiltinFunc
+		Args        []string
+		FS          fs.FS
+		Nullglob    bool
+		Failglob    bool
+		BraceExpand bool
+		Home        HomeFunc
+
+		// status records the status of the last command list if Shell is nil
+		status *Status
+		// cmdStatus records the status of the last command substitution of the
+		// command being expanded
+		cmdStatus *Status
+	}
+
+	// Syntax is implemented by every node of the syntax tree
+	Syntax interface {
+		Pos() Pos
+		End() Pos
+	}
+
+	// Node is a part of an argument which may be evaluated to a string
+	Node interface {
+		Syntax
+		Value(ctx context.Context, env Env) (string, error)
 	}
+)
 
-	Node interface {
-		Value(env Env) (string, error)
+type (
+	// Pos is a position in the source text. Line and Col are 1-indexed, and Col
+	// counts bytes from the start of the line.
+	Pos struct {
+		Offset int
+		Line   int
+		Col    int
+	}
+
+	// span records the start and end position of a node
+	span struct {
+		start Pos
+		end   Pos
 	}
 )
 
+// Pos returns the position of the first byte of the node
+func (s span) Pos() Pos {
+	return s.start
+}
+
+// End returns the position immediately after the node
+func (s span) End() Pos {
+	return s.end
+}
+
+func (s *span) setSpan(start, end Pos) {
+	s.start = start
+	s.end = end
+}
+
 type (
-	nodeText struct {
-		text string
+	// parser parses source text. Every text passed to the parse methods must be
+	// a suffix of src, such that positions may be derived from its length.
+	parser struct {
+		src   string
+		lines []int
+		// noBrace records the offsets of braces which do not form a brace
+		// expansion, such that nested braces are not parsed repeatedly
+		noBrace map[int]struct{}
 	}
 )
 
-func newNodeText(text string) *nodeText {
-	return &nodeText{
-		text: text,
+func newParser(src string) *parser {
+	lines := []int{0}
+	for i := 0; i < len(src); i++ {
+		if isNewline(src[i]) {
+			lines = append(lines, i+1)
+		}
+	}
+	return &parser{
+		src:     src,
+		lines:   lines,
+		noBrace: map[int]struct{}{},
 	}
 }
 
-func (n nodeText) Value(env Env) (string, error) {
-	return n.text, nil
+// pos returns the position of the beginning of text
+func (p *parser) pos(text string) Pos {
+	offset := len(p.src) - len(text)
+	line := sort.Search(len(p.lines), func(i int) bool {
+		return p.lines[i] > offset
+	})
+	return Pos{
+		Offset: offset,
+		Line:   line,
+		Col:    offset - p.lines[line-1] + 1,
+	}
+}
+
+// err creates a parse error located at the beginning of text
+func (p *parser) err(text string, err error) error {
+	k := strings.IndexByte(text, '\n')
+	if k < 0 {
+		k = len(text)
+	}
+	if k > parseErrSnippetLen {
+		k = parseErrSnippetLen
+		for k > 0 && !utf8.RuneStart(text[k]) {
+			k--
+		}
+	}
+	return &ParseError{
+		Pos:     p.pos(text),
+		Snippet: text[0:k],
+		Err:     err,
+	}
+}
+
+type (
+	// Text is unquoted text with escapes removed
+	Text struct {
+		span
+		Text string
+	}
+)
+
+func newText(text string) *Text {
+	return &Text{
+		Text: text,
+	}
+}
+
+func (n Text) Value(ctx context.Context, env Env) (string, error) {
+	return n.Text, nil
 }
 
 type (
-	nodeArg struct {
-		nodes []Node
+	// Arg is a single argument composed of adjacent nodes
+	Arg struct {
+		span
+		Nodes []Node
 	}
 )
 
-func newNodeArg(nodes []Node) *nodeArg {
-	return &nodeArg{
-		nodes: nodes,
+func newArg(nodes []Node) *Arg {
+	return &Arg{
+		Nodes: nodes,
 	}
 }
 
-func (n nodeArg) Value(env Env) (string, error) {
+func (n Arg) Value(ctx context.Context, env Env) (string, error) {
 	s := strings.Builder{}
-	for _, i := range n.nodes {
-		v, err := i.Value(env)
+	for _, i := range n.Nodes {
+		v, err := i.Value(ctx, env)
 		if err != nil {
 			return "", err
 		}
@@ -70,27 +201,130 @@ func (n nodeArg) Value(env Env) (string, error) {
 	return s.String(), nil
 }
 
+// Fields evaluates the argument and splits the results of unquoted variables
+// and command substitutions into multiple fields on the characters of the
+// field separator returned by env.FieldSeparator. Quoted text is never split,
+// and an argument consisting only of expansions that evaluate to whitespace
+// produces no fields. A quoted "$@" expands to a field for each positional
+// parameter. Fields with unquoted pattern characters are then expanded to
+// matching paths. If env.BraceExpand is set, brace expansions are expanded
+// before all other expansions, and otherwise are literal text.
+func (n Arg) Fields(ctx context.Context, env Env) ([]string, error) {
+	words := env.braceNodes(n.Nodes)
+	if len(words) == 1 {
+		return fieldsOf(ctx, env, words[0])
+	}
+	k := []string{}
+	for _, i := range words {
+		v, err := fieldsOf(ctx, env, i)
+		if err != nil {
+			return nil, err
+		}
+		k = append(k, v...)
+	}
+	return k, nil
+}
+
+// fieldsOf evaluates the adjacent nodes of a word into fields
+func fieldsOf(ctx context.Context, env Env, nodes []Node) ([]string, error) {
+	b := newFieldBuilder(env.FieldSeparator())
+	for _, i := range nodes {
+		if k, ok := i.(*StrI); ok && k.hasParamsAll() {
+			if err := k.writeFields(ctx, env, b); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		v, err := i.Value(ctx, env)
+		if err != nil {
+			return nil, err
+		}
+		switch k := i.(type) {
+		case *Text, *StrL, *StrI, *Tilde:
+			b.writeText(v)
+		case *Glob:
+			b.writeGlob(v, k.Pattern)
+		default:
+			b.writeSplit(v)
+		}
+	}
+	return env.expandGlob(b.done(), b.patterns)
+}
+
 // parseArg parses one argument in the current mode
 // takes in a string not beginning with whitespace
-func parseArg(text string, mode int) (*nodeArg, string, error) {
+func (p *parser) parseArg(text string, mode int) (*Arg, string, error) {
+	return p.parseWord(text, mode, false)
+}
+
+// parseWord parses one argument in the current mode. A tilde prefix is
+// recognized at the beginning of the argument, and after each unquoted ':' if
+// assign is set for the value of an assignment.
+// takes in a string not beginning with whitespace
+func (p *parser) parseWord(text string, mode int, assign bool) (*Arg, string, error) {
 	switch mode {
-	case argModeNorm, argModeCmd, argModeSub, argModeVar:
+	case argModeNorm, argModeCmd, argModeSub, argModeVar, argModeBrace:
 	default:
-		return nil, "", ErrInvalidArgMode
+		return nil, "", p.err(text, ErrInvalidArgMode)
 	}
 
+	start := p.pos(text)
+	end := start
 	nodes := []Node{}
 	i := 0
+	// tilde is the index at which a tilde prefix may begin
+	tilde := 0
+	if mode == argModeBrace {
+		tilde = -1
+	}
 	for i < len(text) {
 		ch := text[i]
+		if ch == '~' && i == tilde {
+			if n, next := p.parseTilde(text[i:], mode, assign); n != nil {
+				if i > 0 {
+					k, _, err := p.parseArgText(text, i)
+					if err != nil {
+						return nil, "", err
+					}
+					nodes = append(nodes, k)
+				}
+				nodes = append(nodes, n)
+				text = next
+				i = 0
+				tilde = -1
+				end = p.pos(text)
+				continue
+			}
+		}
 		if ch == '\\' {
 			if i+1 >= len(text) {
-				return nil, "", ErrInvalidEscape
+				return nil, "", p.err(text[i:], ErrInvalidEscape)
 			}
 			i += 2
-		} else if isSpace(ch) || ch == ')' || ch == '}' || ch == '"' || ch == '\'' || ch == '$' {
+		} else if ch == '{' && mode != argModeVar {
+			n, next, err := p.parseBrace(text[i:])
+			if err != nil {
+				return nil, "", err
+			}
+			if n == nil {
+				i++
+				continue
+			}
+			if i > 0 {
+				k, _, err := p.parseArgText(text, i)
+				if err != nil {
+					return nil, "", err
+				}
+				nodes = append(nodes, k)
+			}
+			nodes = append(nodes, n)
+			text = next
+			i = 0
+			tilde = -1
+			end = p.pos(text)
+		} else if isSpace(ch) || ch == ')' || ch == '"' || ch == '\'' || ch == '$' || ch == '`' || isOperator(ch) && mode != argModeVar || isArgEnd(ch, mode) {
 			if i > 0 {
-				n, next, err := parseArgText(text, i)
+				n, next, err := p.parseArgText(text, i)
 				if err != nil {
 					return nil, "", err
 				}
@@ -98,86 +332,120 @@ func parseArg(text string, mode int) (*nodeArg, string, error) {
 				text = next
 				i = 0
 			}
+			tilde = -1
+			end = p.pos(text)
 			if ch == ')' {
 				switch mode {
 				case argModeNorm, argModeVar:
-					return nil, "", ErrInvalidCloseParen
+					return nil, "", p.err(text, ErrInvalidCloseParen)
 				}
 				break
-			} else if ch == '}' {
+			} else if isArgEnd(ch, mode) {
+				break
+			} else if isSpace(ch) {
 				switch mode {
-				case argModeNorm, argModeCmd, argModeSub:
-					return nil, "", ErrInvalidCloseBrace
+				case argModeVar:
+					text = trimLSpace(text)
+				case argModeBrace:
+					// whitespace is not allowed within a brace expansion
+				default:
+					text = trimLBlank(text)
 				}
 				break
-			} else if isSpace(ch) {
-				text = trimLSpace(text)
+			} else if isOperator(ch) {
 				break
 			} else if ch == '"' {
-				n, next, err := parseStrI(text)
+				n, next, err := p.parseStrI(text)
 				if err != nil {
 					return nil, "", err
 				}
 				nodes = append(nodes, n)
 				text = next
+				end = p.pos(text)
 			} else if ch == '\'' {
-				n, next, err := parseStrL(text)
+				n, next, err := p.parseStrL(text)
 				if err != nil {
 					return nil, "", err
 				}
 				nodes = append(nodes, n)
 				text = next
+				end = p.pos(text)
 			} else if ch == '$' {
-				n, next, err := parseVar(text)
+				n, next, err := p.parseVar(text)
+				if err != nil {
+					return nil, "", err
+				}
+				nodes = append(nodes, n)
+				text = next
+				end = p.pos(text)
+			} else if ch == '`' {
+				n, next, err := p.parseBacktick(text, false)
 				if err != nil {
 					return nil, "", err
 				}
 				nodes = append(nodes, n)
 				text = next
+				end = p.pos(text)
 			}
 		} else {
+			if ch == ':' && assign {
+				tilde = i + 1
+			}
 			i++
 		}
 	}
 
 	if i > 0 {
-		n, next, err := parseArgText(text, i)
+		n, next, err := p.parseArgText(text, i)
 		if err != nil {
 			return nil, "", err
 		}
 		nodes = append(nodes, n)
 		text = next
 		i = 0
+		end = p.pos(text)
 	}
 
-	return newNodeArg(nodes), text, nil
+	n := newArg(nodes)
+	n.setSpan(start, end)
+	return n, text, nil
 }
 
-// parseArgText consumes the first i bytes to create a text node
-func parseArgText(text string, i int) (*nodeText, string, error) {
+// parseArgText consumes the first i bytes to create a text node, or a glob
+// node if the text contains unescaped pattern characters
+func (p *parser) parseArgText(text string, i int) (Node, string, error) {
 	k, err := unquoteArg(text[0:i])
 	if err != nil {
-		return nil, "", err
+		return nil, "", p.err(text, err)
+	}
+	if raw := strings.ReplaceAll(text[0:i], "\\\n", ""); hasGlobMeta(raw) {
+		n := newGlob(raw)
+		n.setSpan(p.pos(text), p.pos(text[i:]))
+		return n, text[i:], nil
 	}
-	return newNodeText(k), text[i:], nil
+	n := newText(k)
+	n.setSpan(p.pos(text), p.pos(text[i:]))
+	return n, text[i:], nil
 }
 
 type (
-	nodeStrI struct {
-		nodes []Node
+	// StrI is a double quoted interpolated string
+	StrI struct {
+		span
+		Nodes []Node
 	}
 )
 
-func newNodeStrI(nodes []Node) *nodeStrI {
-	return &nodeStrI{
-		nodes: nodes,
+func newStrI(nodes []Node) *StrI {
+	return &StrI{
+		Nodes: nodes,
 	}
 }
 
-func (n nodeStrI) Value(env Env) (string, error) {
+func (n StrI) Value(ctx context.Context, env Env) (string, error) {
 	s := strings.Builder{}
-	for _, i := range n.nodes {
-		v, err := i.Value(env)
+	for _, i := range n.Nodes {
+		v, err := i.Value(ctx, env)
 		if err != nil {
 			return "", err
 		}
@@ -188,7 +456,8 @@ func (n nodeStrI) Value(env Env) (string, error) {
 
 // parseStrI parses interpolated strings.
 // takes in a string beginning with '"'
-func parseStrI(text string) (*nodeStrI, string, error) {
+func (p *parser) parseStrI(text string) (*StrI, string, error) {
+	start := text
 	nodes := []Node{}
 	text = text[1:]
 	i := 0
@@ -196,24 +465,35 @@ func parseStrI(text string) (*nodeStrI, string, error) {
 		ch := text[i]
 		if ch == '\\' {
 			if i+1 >= len(text) {
-				return nil, "", ErrInvalidEscape
+				return nil, "", p.err(text[i:], ErrInvalidEscape)
 			}
 			i += 2
-		} else if ch == '"' || ch == '$' {
+		} else if ch == '"' || ch == '$' || ch == '`' {
 			if i > 0 {
 				s, err := unquoteStrI(text[0:i])
 				if err != nil {
-					return nil, "", err
+					return nil, "", p.err(text, err)
 				}
-				nodes = append(nodes, newNodeText(s))
+				n := newText(s)
+				n.setSpan(p.pos(text), p.pos(text[i:]))
+				nodes = append(nodes, n)
 				text = text[i:]
 				i = 0
 			}
 			if ch == '"' {
 				text = text[1:]
-				return newNodeStrI(nodes), text, nil
+				n := newStrI(nodes)
+				n.setSpan(p.pos(start), p.pos(text))
+				return n, text, nil
 			} else if ch == '$' {
-				n, next, err := parseVar(text)
+				n, next, err := p.parseVar(text)
+				if err != nil {
+					return nil, "", err
+				}
+				nodes = append(nodes, n)
+				text = next
+			} else if ch == '`' {
+				n, next, err := p.parseBacktick(text, true)
 				if err != nil {
 					return nil, "", err
 				}
@@ -224,28 +504,31 @@ func parseStrI(text string) (*nodeStrI, string, error) {
 			i++
 		}
 	}
-	return nil, "", ErrUnclosedStrI
+	return nil, "", p.err(start, ErrUnclosedStrI)
 }
 
 type (
-	nodeStrL struct {
-		text string
+	// StrL is a single quoted literal string
+	StrL struct {
+		span
+		Text string
 	}
 )
 
-func newNodeStrL(s string) *nodeStrL {
-	return &nodeStrL{
-		text: s,
+func newStrL(s string) *StrL {
+	return &StrL{
+		Text: s,
 	}
 }
 
-func (n nodeStrL) Value(env Env) (string, error) {
-	return n.text, nil
+func (n StrL) Value(ctx context.Context, env Env) (string, error) {
+	return n.Text, nil
 }
 
 // parseStrL parses literal strings.
 // takes in a string beginning with '\''
-func parseStrL(text string) (*nodeStrL, string, error) {
+func (p *parser) parseStrL(text string) (*StrL, string, error) {
+	start := text
 	text = text[1:]
 	i := 0
 	for i < len(text) {
@@ -253,48 +536,114 @@ func parseStrL(text string) (*nodeStrL, string, error) {
 		if ch == '\'' {
 			k := text[0:i]
 			text = text[i+1:]
-			return newNodeStrL(k), text, nil
+			n := newStrL(k)
+			n.setSpan(p.pos(start), p.pos(text))
+			return n, text, nil
 		} else {
 			i++
 		}
 	}
-	return nil, "", ErrUnclosedStrL
+	return nil, "", p.err(start, ErrUnclosedStrL)
 }
 
 type (
-	nodeEnvVar struct {
-		name   string
-		defval []Node
+	// EnvVar is a variable reference which evaluates to Default, if it is
+	// non-nil, when the variable is unset or empty, or only when it is unset if
+	// Unset is true
+	EnvVar struct {
+		span
+		Name    string
+		Default []*Arg
+		Unset   bool
 	}
 )
 
-func newNodeEnvVar(name string, defval []Node) *nodeEnvVar {
-	return &nodeEnvVar{
-		name:   name,
-		defval: defval,
+func newEnvVar(name string, defval []*Arg) *EnvVar {
+	return &EnvVar{
+		Name:    name,
+		Default: defval,
 	}
 }
 
-func (n nodeEnvVar) Value(env Env) (string, error) {
+// LookupVar returns the value of a variable and whether it is set. Variables
+// are looked up in order from Vars, and then the first of Lookup, Envfunc, or
+// Envvar that is non-nil. An empty value returned by Envfunc is treated as
+// unset, and the last entry of Envvar for the variable is used. Variables
+// unset in Shell are not looked up past Vars. Positional and special
+// parameters are looked up from Args and Shell.
+func (env Env) LookupVar(name string) (string, bool) {
+	if isParamName(name) {
+		return env.lookupParam(name)
+	}
+	if v, ok := env.Vars[name]; ok {
+		return v, true
+	}
+	if env.Shell != nil {
+		if _, ok := env.Shell.unset[name]; ok {
+			return "", false
+		}
+	}
+	if env.Lookup != nil {
+		return env.Lookup(name)
+	}
 	if env.Envfunc != nil {
-		k := env.Envfunc(n.name)
-		if len(k) > 0 {
-			return k, nil
+		v := env.Envfunc(name)
+		return v, len(v) > 0
+	}
+	for i := len(env.Envvar) - 1; i >= 0; i-- {
+		if v := strings.TrimPrefix(env.Envvar[i], name+"="); len(v) < len(env.Envvar[i]) {
+			return v, true
 		}
 	}
-	if n.defval == nil {
-		return "", nil
+	return "", false
+}
+
+// lookupRef returns the value of a variable referenced by n without a
+// default, returning an *UnsetVariableError if env.Nounset is set and the
+// variable is unset
+func (env Env) lookupRef(n Syntax, name string) (string, error) {
+	v, ok := env.LookupVar(name)
+	// "$@" and "$*" are exempt as they are unset without positional parameters
+	if !ok && env.Nounset && name != "@" && name != "*" {
+		return "", &UnsetVariableError{
+			Pos:  n.Pos(),
+			Name: name,
+		}
 	}
+	return v, nil
+}
+
+func (n EnvVar) Value(ctx context.Context, env Env) (string, error) {
+	if n.Default == nil {
+		return env.lookupRef(n, n.Name)
+	}
+	if n.usesDefault(env) {
+		return wordValue(ctx, env, n.Default)
+	}
+	v, _ := env.LookupVar(n.Name)
+	return v, nil
+}
+
+// usesDefault reports whether the variable evaluates to its default, which is
+// if it is unset, or empty unless Unset is set
+func (n EnvVar) usesDefault(env Env) bool {
+	if n.Default == nil {
+		return false
+	}
+	v, ok := env.LookupVar(n.Name)
+	return !ok || !n.Unset && len(v) == 0
+}
+
+// wordValue evaluates the word of a parameter expansion, joining its args
+// with spaces
+func wordValue(ctx context.Context, env Env, word []*Arg) (string, error) {
 	s := strings.Builder{}
-	first := true
-	for _, i := range n.defval {
-		v, err := i.Value(env)
+	for n, i := range word {
+		v, err := i.Value(ctx, env)
 		if err != nil {
 			return "", err
 		}
-		if first {
-			first = false
-		} else {
+		if n > 0 {
 			s.WriteByte(' ')
 		}
 		s.WriteString(v)
@@ -302,127 +651,284 @@ func (n nodeEnvVar) Value(env Env) (string, error) {
 	return s.String(), nil
 }
 
-// parseVar parses env vars and command substitutions.
+// parseVar parses env vars, parameters, and command substitutions. Only a
+// single digit positional parameter may be referenced without braces.
 // takes in a string beginning with '$'
-func parseVar(text string) (Node, string, error) {
+func (p *parser) parseVar(text string) (Node, string, error) {
 	if len(text) < 2 {
-		return nil, "", ErrInvalidVar
+		return nil, "", p.err(text, ErrInvalidVar)
 	}
 	k := parseTopEnvVar(text[1:])
+	if k == 0 && (isDigit(text[1]) || isSpecialParam(text[1])) {
+		k = 1
+	}
 	if k > 0 {
+		start := text
 		text = text[1:]
 		name := text[0:k]
 		text = text[k:]
-		return newNodeEnvVar(name, nil), text, nil
+		n := newEnvVar(name, nil)
+		n.setSpan(p.pos(start), p.pos(text))
+		return n, text, nil
 	}
 	ch := text[1]
 	if ch == '{' {
-		return parseVarLong(text)
+		return p.parseVarLong(text)
 	} else if ch == '(' {
-		return parseCmd(text)
+		if strings.HasPrefix(text, "$((") {
+			n, next, err := p.parseArith(text)
+			if err != nil {
+				return nil, "", err
+			}
+			if n != nil {
+				return n, next, nil
+			}
+		}
+		return p.parseCmd(text)
 	}
-	return nil, "", ErrInvalidVar
+	return nil, "", p.err(text, ErrInvalidVar)
 }
 
-// parseVarLong parses long long env vars.
+// parseVarLong parses long env vars and parameter expansions.
 // takes in a string beginning with '${'
-func parseVarLong(text string) (Node, string, error) {
+func (p *parser) parseVarLong(text string) (Node, string, error) {
+	start := text
 	text = text[2:]
-	k := parseTopEnvVar(text)
+	if len(text) > 0 && text[0] == '#' {
+		if k := parseTopParam(text[1:]); k > 0 {
+			name := text[1 : k+1]
+			text = text[k+1:]
+			if len(text) < 1 {
+				return nil, "", p.err(start, ErrUnclosedBrace)
+			}
+			if text[0] != '}' {
+				return nil, "", p.err(start, ErrInvalidVar)
+			}
+			text = text[1:]
+			n := newVarLen(name)
+			n.setSpan(p.pos(start), p.pos(text))
+			return n, text, nil
+		}
+	}
+	k := parseTopParam(text)
 	name := text[0:k]
 	text = text[k:]
 	if len(text) < 1 {
-		return nil, "", ErrUnclosedBrace
+		return nil, "", p.err(start, ErrUnclosedBrace)
+	}
+	if k == 0 {
+		return nil, "", p.err(start, ErrInvalidVar)
 	}
 	if text[0] == '}' {
 		text = text[1:]
-		return newNodeEnvVar(name, nil), text, nil
+		n := newEnvVar(name, nil)
+		n.setSpan(p.pos(start), p.pos(text))
+		return n, text, nil
+	}
+	op := parseVarOp(text)
+	if len(op) == 0 {
+		return nil, "", p.err(start, ErrInvalidVar)
+	}
+	var word []*Arg
+	var next string
+	var err error
+	switch strings.TrimPrefix(op, ":") {
+	case "?", "#", "##", "%", "%%":
+		// messages and patterns are a single word including whitespace
+		word, next, err = p.parseVarRawWord(start, text[len(op):])
+	default:
+		word, next, err = p.parseVarWord(start, text[len(op):])
 	}
-	if len(text) < 2 || text[0:2] != ":-" {
-		return nil, "", ErrInvalidVar
+	if err != nil {
+		return nil, "", err
 	}
+	text = next
+	unset := op[0] != ':'
+	pos, end := p.pos(start), p.pos(text)
+	switch strings.TrimPrefix(op, ":") {
+	case "-":
+		n := newEnvVar(name, word)
+		n.Unset = unset
+		n.setSpan(pos, end)
+		return n, text, nil
+	case "=":
+		n := newVarAssign(name, word, unset)
+		n.setSpan(pos, end)
+		return n, text, nil
+	case "?":
+		n := newVarCheck(name, word, unset)
+		n.setSpan(pos, end)
+		return n, text, nil
+	case "+":
+		n := newVarAlt(name, word, unset)
+		n.setSpan(pos, end)
+		return n, text, nil
+	case "#", "##":
+		n := newVarTrimPrefix(name, word, op == "##")
+		n.setSpan(pos, end)
+		return n, text, nil
+	default:
+		n := newVarTrimSuffix(name, word, op == "%%")
+		n.setSpan(pos, end)
+		return n, text, nil
+	}
+}
 
-	nodes := []Node{}
-	text = trimLSpace(text[2:])
+// parseVarWord parses the args of a parameter expansion word up to and
+// including the closing brace.
+// takes in a string beginning after the operator
+func (p *parser) parseVarWord(start, text string) ([]*Arg, string, error) {
+	nodes := []*Arg{}
+	text = trimLSpace(text)
 	for len(text) > 0 {
 		ch := text[0]
 		if ch == '}' {
-			text = text[1:]
-			return newNodeEnvVar(name, nodes), text, nil
+			return nodes, text[1:], nil
 		}
-		n, next, err := parseArg(text, argModeVar)
+		n, next, err := p.parseArg(text, argModeVar)
 		if err != nil {
 			return nil, "", err
 		}
 		nodes = append(nodes, n)
 		text = next
 	}
-	return nil, "", ErrUnclosedBrace
+	return nil, "", p.err(start, ErrUnclosedBrace)
+}
+
+// parseVarRawWord parses a parameter expansion word as a single arg up to and
+// including the closing brace, where whitespace is kept as text.
+// takes in a string beginning after the operator
+func (p *parser) parseVarRawWord(start, text string) ([]*Arg, string, error) {
+	begin := text
+	nodes := []Node{}
+	for len(text) > 0 {
+		ch := text[0]
+		if ch == '}' {
+			if len(nodes) == 0 {
+				return []*Arg{}, text[1:], nil
+			}
+			n := newArg(nodes)
+			n.setSpan(p.pos(begin), p.pos(text))
+			return []*Arg{n}, text[1:], nil
+		}
+		if isSpace(ch) {
+			next := trimLSpace(text)
+			n := newText(text[0 : len(text)-len(next)])
+			n.setSpan(p.pos(text), p.pos(next))
+			nodes = append(nodes, n)
+			text = next
+			continue
+		}
+		n, _, err := p.parseArg(text, argModeVar)
+		if err != nil {
+			return nil, "", err
+		}
+		nodes = append(nodes, n.Nodes...)
+		// whitespace following the arg is skipped by parseArg
+		text = p.src[n.End().Offset:]
+	}
+	return nil, "", p.err(start, ErrUnclosedBrace)
 }
 
 type (
-	nodeCmd struct {
-		nodes []Node
+	// CmdSub is a command substitution which evaluates to the output of Script
+	CmdSub struct {
+		span
+		Script *Script
 	}
 )
 
-func newNodeCmd(nodes []Node) *nodeCmd {
-	return &nodeCmd{
-		nodes: nodes,
+func newCmdSub(script *Script) *CmdSub {
+	return &CmdSub{
+		Script: script,
 	}
 }
 
-func (n nodeCmd) Value(env Env) (string, error) {
-	if len(n.nodes) == 0 {
+// Value runs the script in a subshell and evaluates to its output without
+// trailing newlines. A non-zero status of the script is recorded as $? rather
+// than returned as an error, unless the script was canceled.
+func (n CmdSub) Value(ctx context.Context, env Env) (string, error) {
+	if len(n.Script.Lists) == 0 {
 		return "", nil
 	}
-	k := make([]string, 0, len(n.nodes))
-	for _, i := range n.nodes {
-		v, err := i.Value(env)
-		if err != nil {
-			return "", err
-		}
-		k = append(k, v)
-	}
 	b := bytes.Buffer{}
-	env.Stdout = &b
-	if err := env.Ex.Exec(k, env); err != nil {
+	sub := env.subshell()
+	sub.Stdout = &b
+	status, err := n.Script.ExecContext(ctx, sub)
+	if err != nil {
 		return "", err
 	}
-	return parseTextNodes(b.String()), nil
-}
-
-func parseTextNodes(text string) string {
-	nodes := []string{}
-	text = trimLSpace(text)
-	for len(text) > 0 {
-		k := nextSpace(text)
-		if k < 0 {
-			k = len(text)
-		}
-		nodes = append(nodes, text[0:k])
-		text = trimLSpace(text[k:])
+	if status.Canceled {
+		return "", status.Err()
+	}
+	env.setStatus(status)
+	if env.cmdStatus != nil {
+		*env.cmdStatus = status
 	}
-	return strings.Join(nodes, " ")
+	return strings.TrimRight(b.String(), "\n"), nil
 }
 
 // parseCmd parses a command substitution.
 // takes in a string beginning with '$('
-func parseCmd(text string) (Node, string, error) {
-	text = trimLSpace(text[2:])
-	nodes := []Node{}
-	for len(text) > 0 {
-		ch := text[0]
-		if ch == ')' {
-			text = text[1:]
-			return newNodeCmd(nodes), text, nil
+func (p *parser) parseCmd(text string) (Node, string, error) {
+	script, next, err := p.parseScript(text[2:], argModeCmd)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(next) == 0 {
+		return nil, "", p.err(text, ErrUnclosedParen)
+	}
+	n := newCmdSub(script)
+	n.setSpan(p.pos(text), p.pos(next[1:]))
+	return n, next[1:], nil
+}
+
+// parseBacktick parses a command substitution in backquotes. A backslash
+// within the backquotes escapes '$', '`', and '\', and also '"' if strI is set
+// for backquotes within a double quoted string, and is otherwise retained.
+// takes in a string beginning with '`'
+func (p *parser) parseBacktick(text string, strI bool) (Node, string, error) {
+	start := text
+	s := strings.Builder{}
+	// offsets maps each offset of the unescaped command to the source
+	offsets := []int{}
+	i := 1
+	for ; i < len(text) && text[i] != '`'; i++ {
+		offsets = append(offsets, len(p.src)-len(text)+i)
+		if text[i] == '\\' && i+1 < len(text) {
+			switch text[i+1] {
+			case '$', '`', '\\':
+				i++
+			case '"':
+				if strI {
+					i++
+				}
+			}
 		}
-		n, next, err := parseArg(text, argModeCmd)
-		if err != nil {
-			return nil, "", err
+		s.WriteByte(text[i])
+	}
+	if i >= len(text) {
+		return nil, "", p.err(start, ErrUnclosedBacktick)
+	}
+	offsets = append(offsets, len(p.src)-len(text)+i)
+	next := text[i+1:]
+
+	src := s.String()
+	script, _, err := newParser(src).parseScript(src, argModeNorm)
+	if err != nil {
+		var perr *ParseError
+		if errors.As(err, &perr) {
+			return nil, "", p.err(p.src[offsets[perr.Pos.Offset]:], perr.Err)
 		}
-		nodes = append(nodes, n)
-		text = next
+		return nil, "", err
 	}
-	return nil, "", ErrUnclosedParen
+	Inspect(script, func(n Syntax) bool {
+		if k, ok := n.(interface{ setSpan(start, end Pos) }); ok {
+			k.setSpan(p.pos(p.src[offsets[n.Pos().Offset]:]), p.pos(p.src[offsets[n.End().Offset]:]))
+		}
+		return true
+	})
+	n := newCmdSub(script)
+	n.setSpan(p.pos(start), p.pos(next))
+	return n, next, nil
 }
@@ -1,7 +1,11 @@
 package nutcracker
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"os"
 	"testing"
 )
 
@@ -11,86 +15,86 @@ func Test_parseArg(t *testing.T) {
 	exec := NewExecutor()
 	{
 		arg := `hello world `
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("world ", next, "only the first argument should be parsed")
-		assert.Equal(newNodeArg([]Node{newNodeText("hello")}), n, "only the first argument should be parsed")
-		v, err := n.Value(Env{})
+		assert.Equal(newArg([]Node{newText("hello")}), stripSpan(n), "only the first argument should be parsed")
+		v, err := n.Value(context.Background(), Env{})
 		assert.NoError(err, "node value should not error")
 		assert.Equal("hello", v, "value returns correct arg value")
 	}
 	{
 		arg := `hello\ world\
 ! kevin `
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("kevin ", next, "escape will escape spaces and eliminate newline")
-		assert.Equal(newNodeArg([]Node{newNodeText("hello world!")}), n, "escape will escape spaces and eliminate newline")
-		v, err := n.Value(Env{})
+		assert.Equal(newArg([]Node{newText("hello world!")}), stripSpan(n), "escape will escape spaces and eliminate newline")
+		v, err := n.Value(context.Background(), Env{})
 		assert.NoError(err, "node value should not error")
 		assert.Equal("hello world!", v, "value returns correct arg value")
 	}
 	{
 		arg := `hello\ world`
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("", next, "escape will escape spaces")
-		assert.Equal(newNodeArg([]Node{newNodeText("hello world")}), n, "escape will escape spaces")
-		v, err := n.Value(Env{})
+		assert.Equal(newArg([]Node{newText("hello world")}), stripSpan(n), "escape will escape spaces")
+		v, err := n.Value(context.Background(), Env{})
 		assert.NoError(err, "node value should not error")
 		assert.Equal("hello world", v, "value returns correct arg value")
 	}
 	{
 		arg := `"hello\ 'world"`
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("", next, "interpolated string will include spaces and single quotes")
-		assert.Equal(newNodeArg([]Node{newNodeStrI([]Node{newNodeText("hello\\ 'world")})}), n, "interpolated string will include spaces and single quotes")
-		v, err := n.Value(Env{})
+		assert.Equal(newArg([]Node{newStrI([]Node{newText("hello\\ 'world")})}), stripSpan(n), "interpolated string will include spaces and single quotes")
+		v, err := n.Value(context.Background(), Env{})
 		assert.NoError(err, "node value should not error")
 		assert.Equal("hello\\ 'world", v, "value returns correct arg value")
 	}
 	{
 		arg := `"hello\
 'world" kevin `
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("kevin ", next, "interpolated string will eliminate escaped newline")
-		assert.Equal(newNodeArg([]Node{newNodeStrI([]Node{newNodeText("hello'world")})}), n, "interpolated string will eliminate escaped newline")
-		v, err := n.Value(Env{})
+		assert.Equal(newArg([]Node{newStrI([]Node{newText("hello'world")})}), stripSpan(n), "interpolated string will eliminate escaped newline")
+		v, err := n.Value(context.Background(), Env{})
 		assert.NoError(err, "node value should not error")
 		assert.Equal("hello'world", v, "value returns correct arg value")
 	}
 	{
 		arg := `"hello\$ world"\$ kevin `
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("kevin ", next, "parse arg will include adjacent nodes")
-		assert.Equal(newNodeArg([]Node{newNodeStrI([]Node{newNodeText("hello$ world")}), newNodeText("$")}), n, "parse arg will include adjacent nodes")
-		v, err := n.Value(Env{})
+		assert.Equal(newArg([]Node{newStrI([]Node{newText("hello$ world")}), newText("$")}), stripSpan(n), "parse arg will include adjacent nodes")
+		v, err := n.Value(context.Background(), Env{})
 		assert.NoError(err, "node value should not error")
 		assert.Equal("hello$ world$", v, "value returns correct arg value")
 	}
 	{
 		arg := `'hello\$ world'\$ kevin `
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("kevin ", next, "text in literal quote remains unchanged")
-		assert.Equal(newNodeArg([]Node{newNodeStrL("hello\\$ world"), newNodeText("$")}), n, "text in literal quote remains unchanged")
-		v, err := n.Value(Env{})
+		assert.Equal(newArg([]Node{newStrL("hello\\$ world"), newText("$")}), stripSpan(n), "text in literal quote remains unchanged")
+		v, err := n.Value(context.Background(), Env{})
 		assert.NoError(err, "node value should not error")
 		assert.Equal("hello\\$ world$", v, "value returns correct arg value")
 	}
 	{
 		arg := `$hello\ ${world}kevin `
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("", next, "all variables should be consumed")
-		assert.Equal(newNodeArg([]Node{newNodeEnvVar("hello", nil), newNodeText(" "), newNodeEnvVar("world", nil), newNodeText("kevin")}), n, "text in literal quote remains unchanged")
-		v, err := n.Value(Env{})
+		assert.Equal(newArg([]Node{newEnvVar("hello", nil), newText(" "), newEnvVar("world", nil), newText("kevin")}), stripSpan(n), "text in literal quote remains unchanged")
+		v, err := n.Value(context.Background(), Env{})
 		assert.NoError(err, "node value should not error")
 		assert.Equal(" kevin", v, "value returns correct arg value")
-		v, err = n.Value(Env{Envfunc: func(s string) string {
+		v, err = n.Value(context.Background(), Env{Envfunc: func(s string) string {
 			if s == "hello" {
 				return "kevin"
 			} else if s == "world" {
@@ -103,21 +107,21 @@ func Test_parseArg(t *testing.T) {
 	}
 	{
 		arg := `${world:-  some   default      value}kevin `
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("", next, "all variables should be consumed")
-		assert.Equal(newNodeArg([]Node{newNodeEnvVar("world", []Node{newNodeArg([]Node{newNodeText("some")}), newNodeArg([]Node{newNodeText("default")}), newNodeArg([]Node{newNodeText("value")})}), newNodeText("kevin")}), n, "default value is parsed by arguments")
-		v, err := n.Value(Env{})
+		assert.Equal(newArg([]Node{newEnvVar("world", []*Arg{newArg([]Node{newText("some")}), newArg([]Node{newText("default")}), newArg([]Node{newText("value")})}), newText("kevin")}), stripSpan(n), "default value is parsed by arguments")
+		v, err := n.Value(context.Background(), Env{})
 		assert.NoError(err, "node value should not error")
 		assert.Equal("some default valuekevin", v, "value returns correct arg value")
 	}
 	{
 		arg := `${world:-$hello}kevin`
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("", next, "all variables should be consumed")
-		assert.Equal(newNodeArg([]Node{newNodeEnvVar("world", []Node{newNodeArg([]Node{newNodeEnvVar("hello", nil)})}), newNodeText("kevin")}), n, "default value is parsed as arg")
-		v, err := n.Value(Env{Envfunc: func(s string) string {
+		assert.Equal(newArg([]Node{newEnvVar("world", []*Arg{newArg([]Node{newEnvVar("hello", nil)})}), newText("kevin")}), stripSpan(n), "default value is parsed as arg")
+		v, err := n.Value(context.Background(), Env{Envfunc: func(s string) string {
 			if s == "hello" {
 				return "greetings"
 			}
@@ -128,11 +132,11 @@ func Test_parseArg(t *testing.T) {
 	}
 	{
 		arg := `"${world:-$hello }  $hello"kevin`
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("", next, "all variables should be consumed")
-		assert.Equal(newNodeArg([]Node{newNodeStrI([]Node{newNodeEnvVar("world", []Node{newNodeArg([]Node{newNodeEnvVar("hello", nil)})}), newNodeText("  "), newNodeEnvVar("hello", nil)}), newNodeText("kevin")}), n, "args in strings are parsed")
-		v, err := n.Value(Env{Envfunc: func(s string) string {
+		assert.Equal(newArg([]Node{newStrI([]Node{newEnvVar("world", []*Arg{newArg([]Node{newEnvVar("hello", nil)})}), newText("  "), newEnvVar("hello", nil)}), newText("kevin")}), stripSpan(n), "args in strings are parsed")
+		v, err := n.Value(context.Background(), Env{Envfunc: func(s string) string {
 			if s == "hello" {
 				return "greetings"
 			}
@@ -143,145 +147,298 @@ func Test_parseArg(t *testing.T) {
 	}
 	{
 		arg := `$(echo hello)kevin`
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("", next, "all variables should be consumed")
-		assert.Equal(newNodeArg([]Node{newNodeCmd([]Node{newNodeArg([]Node{newNodeText("echo")}), newNodeArg([]Node{newNodeText("hello")})}), newNodeText("kevin")}), n, "command substitution is parsed")
-		v, err := n.Value(Env{Ex: exec})
+		assert.Equal(newArg([]Node{newCmdSub(newScript([]*AndOr{newAndOr([]*Pipeline{newPipeline([]*Cmd{newCmd([]*Arg{newArg([]Node{newText("echo")}), newArg([]Node{newText("hello")})}, []*Redirect{})})}, []int{})})), newText("kevin")}), stripSpan(n), "command substitution is parsed")
+		v, err := n.Value(context.Background(), Env{Ex: exec})
 		assert.NoError(err, "node value should not error")
 		assert.Equal("hellokevin", v, "value returns correct arg value")
 	}
 	{
 		arg := `$(echo -n "hello   world")kevin`
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("", next, "all variables should be consumed")
-		assert.Equal(newNodeArg([]Node{newNodeCmd([]Node{newNodeArg([]Node{newNodeText("echo")}), newNodeArg([]Node{newNodeText("-n")}), newNodeArg([]Node{newNodeStrI([]Node{newNodeText("hello   world")})})}), newNodeText("kevin")}), n, "command substitution is parsed")
-		v, err := n.Value(Env{Ex: exec})
+		assert.Equal(newArg([]Node{newCmdSub(newScript([]*AndOr{newAndOr([]*Pipeline{newPipeline([]*Cmd{newCmd([]*Arg{newArg([]Node{newText("echo")}), newArg([]Node{newText("-n")}), newArg([]Node{newStrI([]Node{newText("hello   world")})})}, []*Redirect{})})}, []int{})})), newText("kevin")}), stripSpan(n), "command substitution is parsed")
+		v, err := n.Value(context.Background(), Env{Ex: exec})
 		assert.NoError(err, "node value should not error")
-		assert.Equal("hello worldkevin", v, "value returns correct arg value")
+		assert.Equal("hello   worldkevin", v, "value returns unsplit arg value")
+		fields, err := n.Fields(context.Background(), Env{Ex: exec})
+		assert.NoError(err, "node fields should not error")
+		assert.Equal([]string{"hello", "worldkevin"}, fields, "fields splits command substitution output")
 	}
 	{
 		arg := `$()kevin`
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("", next, "all variables should be consumed")
-		assert.Equal(newNodeArg([]Node{newNodeCmd([]Node{}), newNodeText("kevin")}), n, "empty command substitution is parsed")
-		v, err := n.Value(Env{Ex: exec})
+		assert.Equal(newArg([]Node{newCmdSub(newScript([]*AndOr{})), newText("kevin")}), stripSpan(n), "empty command substitution is parsed")
+		v, err := n.Value(context.Background(), Env{Ex: exec})
 		assert.NoError(err, "node value should not error")
 		assert.Equal("kevin", v, "value returns correct arg value")
 	}
 	{
 		arg := `"$(bogus hello)"kevin`
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("", next, "all variables should be consumed")
-		assert.Equal(newNodeArg([]Node{newNodeStrI([]Node{newNodeCmd([]Node{newNodeArg([]Node{newNodeText("bogus")}), newNodeArg([]Node{newNodeText("hello")})})}), newNodeText("kevin")}), n, "command substitution is parsed")
-		_, err = n.Value(Env{Ex: exec})
+		assert.Equal(newArg([]Node{newStrI([]Node{newCmdSub(newScript([]*AndOr{newAndOr([]*Pipeline{newPipeline([]*Cmd{newCmd([]*Arg{newArg([]Node{newText("bogus")}), newArg([]Node{newText("hello")})}, []*Redirect{})})}, []int{})}))}), newText("kevin")}), stripSpan(n), "command substitution is parsed")
+		_, err = n.Value(context.Background(), Env{Ex: exec})
 		assert.Error(err, "node value should error on invalid command")
 	}
 	{
 		arg := `${world:-$(bogus hello)}kevin`
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("", next, "all variables should be consumed")
-		assert.Equal(newNodeArg([]Node{newNodeEnvVar("world", []Node{newNodeArg([]Node{newNodeCmd([]Node{newNodeArg([]Node{newNodeText("bogus")}), newNodeArg([]Node{newNodeText("hello")})})})}), newNodeText("kevin")}), n, "command substitution is parsed")
-		_, err = n.Value(Env{Ex: exec})
+		assert.Equal(newArg([]Node{newEnvVar("world", []*Arg{newArg([]Node{newCmdSub(newScript([]*AndOr{newAndOr([]*Pipeline{newPipeline([]*Cmd{newCmd([]*Arg{newArg([]Node{newText("bogus")}), newArg([]Node{newText("hello")})}, []*Redirect{})})}, []int{})}))})}), newText("kevin")}), stripSpan(n), "command substitution is parsed")
+		_, err = n.Value(context.Background(), Env{Ex: exec})
 		assert.Error(err, "node value should error on invalid command")
 	}
 	{
 		arg := `$(bogus $(bogus hello))kevin`
-		n, next, err := parseArg(arg, argModeNorm)
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
 		assert.NoError(err, "parse arg should not error")
 		assert.Equal("", next, "all variables should be consumed")
-		assert.Equal(newNodeArg([]Node{newNodeCmd([]Node{newNodeArg([]Node{newNodeText("bogus")}), newNodeArg([]Node{newNodeCmd([]Node{newNodeArg([]Node{newNodeText("bogus")}), newNodeArg([]Node{newNodeText("hello")})})})}), newNodeText("kevin")}), n, "command substitution is parsed")
-		_, err = n.Value(Env{Ex: exec})
+		assert.Equal(newArg([]Node{newCmdSub(newScript([]*AndOr{newAndOr([]*Pipeline{newPipeline([]*Cmd{newCmd([]*Arg{newArg([]Node{newText("bogus")}), newArg([]Node{newCmdSub(newScript([]*AndOr{newAndOr([]*Pipeline{newPipeline([]*Cmd{newCmd([]*Arg{newArg([]Node{newText("bogus")}), newArg([]Node{newText("hello")})}, []*Redirect{})})}, []int{})}))})}, []*Redirect{})})}, []int{})})), newText("kevin")}), stripSpan(n), "command substitution is parsed")
+		_, err = n.Value(context.Background(), Env{Ex: exec})
 		assert.Error(err, "node value should error on invalid command")
 	}
 	{
 		arg := `$(bogus `
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrUnclosedParen, err, "parse arg should not error")
+		_, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrUnclosedParen), "parse arg should not error")
 	}
 	{
 		arg := `$(bogus \`
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrInvalidEscape, err, "parse arg should not error")
+		_, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrInvalidEscape), "parse arg should not error")
 	}
 	{
 		arg := `hello\ world\`
-		_, _, err := parseArg(arg, -1)
-		assert.Equal(ErrInvalidArgMode, err, "parse arg should error on invalid mode")
+		_, _, err := newParser(arg).parseArg(arg, -1)
+		assert.True(errors.Is(err, ErrInvalidArgMode), "parse arg should error on invalid mode")
 	}
 	{
 		arg := `hello\ world\`
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrInvalidEscape, err, "parse arg should error on invalid escape")
+		_, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrInvalidEscape), "parse arg should error on invalid escape")
 	}
 	{
 		arg := `hello\ $`
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrInvalidVar, err, "parse arg should error on invalid var")
+		_, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrInvalidVar), "parse arg should error on invalid var")
 	}
 	{
 		arg := `hello\ ${hello`
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrUnclosedBrace, err, "parse arg should error on invalid var")
+		_, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrUnclosedBrace), "parse arg should error on invalid var")
 	}
 	{
 		arg := `hello\ ${hello:-`
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrUnclosedBrace, err, "parse arg should error on invalid var")
+		_, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrUnclosedBrace), "parse arg should error on invalid var")
 	}
 	{
 		arg := `hello\ "$"`
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrInvalidVar, err, "parse arg should error on invalid var in string")
+		_, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrInvalidVar), "parse arg should error on invalid var in string")
 	}
 	{
 		arg := `hello\ "${"`
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrInvalidVar, err, "parse arg should error on invalid var in string")
+		_, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrInvalidVar), "parse arg should error on invalid var in string")
 	}
 	{
 		arg := `hello\ "${hello"`
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrInvalidVar, err, "parse arg should error on invalid var in string")
+		_, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrInvalidVar), "parse arg should error on invalid var in string")
 	}
 	{
 		arg := `hello\ "${hello:-`
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrUnclosedBrace, err, "parse arg should error on invalid var in string")
+		_, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrUnclosedBrace), "parse arg should error on invalid var in string")
 	}
 	{
 		arg := `hello\ "${hello:- $}"`
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrInvalidVar, err, "parse arg should error on invalid arg in default value")
+		_, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrInvalidVar), "parse arg should error on invalid arg in default value")
 	}
 	{
 		arg := `"hello\$ world\`
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrInvalidEscape, err, "parse arg should error on invalid escape")
+		_, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrInvalidEscape), "parse arg should error on invalid escape")
 	}
 	{
 		arg := `hello) world`
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrInvalidCloseParen, err, "parse arg should error on invalid mode")
+		_, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrInvalidCloseParen), "parse arg should error on invalid mode")
 	}
 	{
 		arg := `hello} world`
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrInvalidCloseBrace, err, "parse arg should error on invalid mode")
+		n, next, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		assert.Equal("world", next, "rest of the text should be returned")
+		assert.Equal(newArg([]Node{newText("hello}")}), stripSpan(n), "unmatched close brace should be text")
 	}
 	{
 		arg := `'hello\$ world\`
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrUnclosedStrL, err, "parse arg should error on unclosed literal string")
+		_, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrUnclosedStrL), "parse arg should error on unclosed literal string")
 	}
 	{
 		arg := `"hello\$ world`
-		_, _, err := parseArg(arg, argModeNorm)
-		assert.Equal(ErrUnclosedStrI, err, "parse arg should error on unclosed interpolated string")
+		_, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrUnclosedStrI), "parse arg should error on unclosed interpolated string")
+	}
+}
+
+func Test_Arg_Fields(t *testing.T) {
+	assert := assert.New(t)
+
+	exec := NewExecutor()
+	envfunc := func(s string) string {
+		switch s {
+		case "files":
+			return "a.txt  b.txt\tc.txt"
+		case "pad":
+			return " x "
+		case "space":
+			return "  "
+		}
+		return ""
+	}
+	env := Env{Envfunc: envfunc, Ex: exec}
+	for _, i := range []struct {
+		arg    string
+		fields []string
+	}{
+		{arg: `$files`, fields: []string{"a.txt", "b.txt", "c.txt"}},
+		{arg: `"$files"`, fields: []string{"a.txt  b.txt\tc.txt"}},
+		{arg: `pre$files.bak`, fields: []string{"prea.txt", "b.txt", "c.txt.bak"}},
+		{arg: `a$pad$pad'b'`, fields: []string{"a", "x", "x", "b"}},
+		{arg: `$space`, fields: []string{}},
+		{arg: `$bogus`, fields: []string{}},
+		{arg: `''$space`, fields: []string{""}},
+		{arg: `"$bogus"`, fields: []string{""}},
+		{arg: `${bogus:-a b}`, fields: []string{"a", "b"}},
+		{arg: `$(printf 'a\nb c\n\n')`, fields: []string{"a", "b", "c"}},
+		{arg: `"$(printf 'a\nb c\n\n')"`, fields: []string{"a\nb c"}},
+	} {
+		n, _, err := newParser(i.arg).parseArg(i.arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		fields, err := n.Fields(context.Background(), env)
+		assert.NoError(err, "node fields should not error")
+		assert.Equal(i.fields, fields, "fields should be split for %s", i.arg)
+	}
+}
+
+func Test_Env_LookupVar(t *testing.T) {
+	assert := assert.New(t)
+
+	lookup := func(s string) (string, bool) {
+		switch s {
+		case "a":
+			return "lookup", true
+		case "empty":
+			return "", true
+		}
+		return "", false
+	}
+	envfunc := func(s string) string {
+		if s == "a" || s == "b" {
+			return "envfunc"
+		}
+		return ""
+	}
+	envvar := []string{"a=envvar", "empty=", "c=first", "c=last"}
+	{
+		env := Env{Vars: map[string]string{"a": "vars"}, Lookup: lookup, Envfunc: envfunc, Envvar: envvar}
+		v, ok := env.LookupVar("a")
+		assert.True(ok, "variable should be set")
+		assert.Equal("vars", v, "vars should take precedence")
+		v, ok = env.LookupVar("b")
+		assert.False(ok, "lookup should take precedence over envfunc")
+		assert.Equal("", v, "unset variable should be empty")
+		v, ok = env.LookupVar("empty")
+		assert.True(ok, "lookup should distinguish empty variables")
+		assert.Equal("", v, "empty variable should be empty")
+	}
+	{
+		env := Env{Envfunc: envfunc, Envvar: envvar}
+		v, ok := env.LookupVar("b")
+		assert.True(ok, "variable should be set")
+		assert.Equal("envfunc", v, "envfunc should take precedence over envvar")
+		_, ok = env.LookupVar("c")
+		assert.False(ok, "envvar should not be used with envfunc")
+		_, ok = env.LookupVar("bogus")
+		assert.False(ok, "empty envfunc value should be unset")
+	}
+	{
+		env := Env{Envvar: envvar}
+		v, ok := env.LookupVar("c")
+		assert.True(ok, "variable should be set")
+		assert.Equal("last", v, "the last envvar entry should be used")
+		v, ok = env.LookupVar("empty")
+		assert.True(ok, "empty envvar entry should be set")
+		assert.Equal("", v, "empty variable should be empty")
+		_, ok = env.LookupVar("emp")
+		assert.False(ok, "variable names should match exactly")
+	}
+	{
+		arg := `${empty-def}:${empty:-def}:${bogus-def}`
+		n, _, err := newParser(arg).parseArg(arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		v, err := n.Value(context.Background(), Env{Lookup: lookup})
+		assert.NoError(err, "value should not error")
+		assert.Equal(":def:def", v, "unset should be distinguished from empty")
+	}
+	{
+		k, ok := os.LookupEnv("PATH")
+		v, vok := Env{Lookup: os.LookupEnv}.LookupVar("PATH")
+		assert.Equal(ok, vok, "os lookup should be usable")
+		assert.Equal(k, v, "os lookup should be usable")
+	}
+}
+
+func Test_Env_Nounset(t *testing.T) {
+	assert := assert.New(t)
+
+	env := Env{Vars: map[string]string{"empty": ""}, Nounset: true}
+	for _, i := range []string{
+		`$empty`,
+		`${bogus-def}`,
+		`${bogus:-def}`,
+		`${bogus+alt}`,
+		`"${unset:=def}"`,
+	} {
+		n, _, err := newParser(i).parseArg(i, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		_, err = n.Value(context.Background(), env)
+		assert.NoError(err, "value of %s should not error", i)
+	}
+	assert.Equal("def", env.Vars["unset"], "assigned variable should be set")
+	for _, i := range []string{
+		`$bogus`,
+		`"a ${bogus}"`,
+		`${#bogus}`,
+		`${bogus#a}`,
+		`${bogus%a}`,
+		`${a:-$bogus}`,
+	} {
+		n, _, err := newParser(i).parseArg(i, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		_, err = n.Value(context.Background(), env)
+		var uerr *UnsetVariableError
+		assert.True(errors.As(err, &uerr), "value of %s should error on unset variable", i)
+	}
+	{
+		arg := "echo hello\necho $HOME $bogus"
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Lookup: os.LookupEnv, Ex: NewExecutor(), Stdout: &bytes.Buffer{}, Nounset: true})
+		assert.Equal(&UnsetVariableError{Pos: Pos{Offset: 22, Line: 2, Col: 12}, Name: "bogus"}, err, "unset variable error should contain the name and position")
 	}
 }
 
@@ -290,7 +447,71 @@ func Test_parseArgText(t *testing.T) {
 
 	{
 		arg := `hello \`
-		_, _, err := parseArgText(arg, len(arg))
-		assert.Equal(ErrInvalidEscape, err, "parse arg text should error on invalid escape")
+		_, _, err := newParser(arg).parseArgText(arg, len(arg))
+		assert.True(errors.Is(err, ErrInvalidEscape), "parse arg text should error on invalid escape")
+	}
+}
+
+func Test_parseBacktick(t *testing.T) {
+	assert := assert.New(t)
+
+	script := func(src string) *Script {
+		n, err := Parse(src)
+		assert.NoError(err, "Parse should not error")
+		return stripSpan(n).(*Script)
+	}
+	for _, i := range []struct {
+		arg   string
+		nodes []Node
+	}{
+		{arg: "`echo a`b", nodes: []Node{newCmdSub(script(`echo a`)), newText("b")}},
+		{arg: "`echo \\`echo b\\` \\$c \\\\d \\e \\\"f\\\"`", nodes: []Node{newCmdSub(script("echo `echo b` $c \\d \\e \\\"f\\\""))}},
+		{arg: "\"a `echo \\\"b\\\" \\$c` d\"", nodes: []Node{newStrI([]Node{newText("a "), newCmdSub(script(`echo "b" $c`)), newText(" d")})}},
+		{arg: "\"a\\`b\"", nodes: []Node{newStrI([]Node{newText("a`b")})}},
+		{arg: "\\`a", nodes: []Node{newText("`a")}},
+		{arg: "'`a`'", nodes: []Node{newStrL("`a`")}},
+		{arg: "${a:-`b`}", nodes: []Node{newEnvVar("a", []*Arg{newArg([]Node{newCmdSub(script(`b`))})})}},
+		{arg: "$((`echo 1` + 1))", nodes: []Node{newArith([]Node{newCmdSub(script(`echo 1`)), newText(" + 1")})}},
+		{arg: "``", nodes: []Node{newCmdSub(script(``))}},
+	} {
+		n, _, err := newParser(i.arg).parseArg(i.arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error for %q", i.arg)
+		assert.Equal(newArg(i.nodes), stripSpan(n), "backquotes should be parsed for %q", i.arg)
+	}
+	{
+		arg := "echo `cat \\$a`"
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		Inspect(n, func(n Syntax) bool {
+			if n != nil {
+				assert.True(n.End().Offset <= len(arg), "spans should be within the source")
+			}
+			if k, ok := n.(*EnvVar); ok {
+				assert.Equal(`\$a`, arg[k.Pos().Offset:k.End().Offset], "spans should be located in the source")
+				assert.Equal(Pos{Offset: 10, Line: 1, Col: 11}, k.Pos(), "spans should be located in the source")
+			}
+			return true
+		})
+	}
+	{
+		arg := "echo `cat"
+		_, err := Parse(arg)
+		assert.True(errors.Is(err, ErrUnclosedBacktick), "unclosed backquote should error")
+	}
+	{
+		arg := "echo `cat \\$(a` b"
+		_, err := Parse(arg)
+		var perr *ParseError
+		assert.True(errors.As(err, &perr), "errors within backquotes should be parse errors")
+		assert.True(errors.Is(err, ErrUnclosedParen), "errors within backquotes should be returned")
+		assert.Equal(Pos{Offset: 10, Line: 1, Col: 11}, perr.Pos, "errors within backquotes should be located in the source")
+	}
+	{
+		b := bytes.Buffer{}
+		n, err := Parse("echo `echo a  b` \"`echo 'c  d'`\" `echo \\`echo e\\``")
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Builtins: DefaultBuiltins(), Stdout: &b})
+		assert.NoError(err, "script should not error")
+		assert.Equal("a b c  d e\n", b.String(), "backquotes should be substituted with the output of the command")
 	}
 }
@@ -0,0 +1,158 @@
+package nutcracker
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// matchPattern reports whether s matches the shell pattern, where '*' matches
+// any string, '?' matches any character, '[...]' matches a character class,
+// and '\' escapes the following character
+func matchPattern(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if i < len(s) && !utf8.RuneStart(s[i]) {
+					continue
+				}
+				if matchPattern(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			_, k := utf8.DecodeRuneInString(s)
+			s = s[k:]
+			pattern = pattern[1:]
+			continue
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			r, k := utf8.DecodeRuneInString(s)
+			if ok, n := matchClass(pattern, r); n > 0 {
+				if !ok {
+					return false
+				}
+				s = s[k:]
+				pattern = pattern[n:]
+				continue
+			}
+			// an unclosed class is matched literally
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+		}
+		r, k := utf8.DecodeRuneInString(pattern)
+		if len(s) == 0 {
+			return false
+		}
+		c, l := utf8.DecodeRuneInString(s)
+		if r != c {
+			return false
+		}
+		pattern = pattern[k:]
+		s = s[l:]
+	}
+	return len(s) == 0
+}
+
+// matchClass reports whether r matches the character class at the beginning
+// of pattern, and returns the length of the class, or 0 if it is unclosed.
+// takes in a string beginning with '['
+func matchClass(pattern string, r rune) (bool, int) {
+	i := 1
+	negate := false
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		negate = true
+		i++
+	}
+	match := false
+	first := true
+	for i < len(pattern) {
+		if pattern[i] == ']' && !first {
+			return match != negate, i + 1
+		}
+		first = false
+		lo, k := decodeClassRune(pattern[i:])
+		i += k
+		hi := lo
+		if i+1 < len(pattern) && pattern[i] == '-' && pattern[i+1] != ']' {
+			hi, k = decodeClassRune(pattern[i+1:])
+			i += 1 + k
+		}
+		if lo <= r && r <= hi {
+			match = true
+		}
+	}
+	return false, 0
+}
+
+// decodeClassRune decodes a possibly escaped character of a character class
+func decodeClassRune(s string) (rune, int) {
+	if s[0] == '\\' && len(s) > 1 {
+		r, k := utf8.DecodeRuneInString(s[1:])
+		return r, k + 1
+	}
+	return utf8.DecodeRuneInString(s)
+}
+
+// escapePattern escapes s such that it is matched literally as a pattern
+func escapePattern(s string) string {
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// trimPrefixPattern removes the shortest prefix of s matching pattern, or the
+// longest if longest is true
+func trimPrefixPattern(s, pattern string, longest bool) string {
+	if longest {
+		for i := len(s); i >= 0; i-- {
+			if (i == len(s) || utf8.RuneStart(s[i])) && matchPattern(pattern, s[:i]) {
+				return s[i:]
+			}
+		}
+		return s
+	}
+	for i := 0; i <= len(s); i++ {
+		if (i == len(s) || utf8.RuneStart(s[i])) && matchPattern(pattern, s[:i]) {
+			return s[i:]
+		}
+	}
+	return s
+}
+
+// trimSuffixPattern removes the shortest suffix of s matching pattern, or the
+// longest if longest is true
+func trimSuffixPattern(s, pattern string, longest bool) string {
+	if longest {
+		for i := 0; i <= len(s); i++ {
+			if (i == len(s) || utf8.RuneStart(s[i])) && matchPattern(pattern, s[i:]) {
+				return s[:i]
+			}
+		}
+		return s
+	}
+	for i := len(s); i >= 0; i-- {
+		if (i == len(s) || utf8.RuneStart(s[i])) && matchPattern(pattern, s[i:]) {
+			return s[:i]
+		}
+	}
+	return s
+}
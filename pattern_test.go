@@ -0,0 +1,63 @@
+package nutcracker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_matchPattern(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, i := range []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"*", "", true},
+		{"*", "a/b.c", true},
+		{"*.go", "main.go", true},
+		{"*.go", "main.gox", false},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"?", "é", true},
+		{"??", "é", false},
+		{"[abc]x", "bx", true},
+		{"[abc]x", "dx", false},
+		{"[!abc]x", "dx", true},
+		{"[^abc]x", "ax", false},
+		{"[a-z0-9]", "5", true},
+		{"[a-z]", "A", false},
+		{"[]a]", "]", true},
+		{"[a-]", "-", true},
+		{"[ab", "[ab", true},
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{`[\]]`, "]", true},
+		{`a\`, `a\`, true},
+	} {
+		assert.Equal(i.match, matchPattern(i.pattern, i.s), "pattern %q should match %q: %t", i.pattern, i.s, i.match)
+	}
+}
+
+func Test_escapePattern(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(`\*\?\[a]\\`, escapePattern(`*?[a]\`), "pattern characters should be escaped")
+	assert.True(matchPattern(escapePattern(`*?[a]\`), `*?[a]\`), "escaped pattern should match literally")
+}
+
+func Test_trimPattern(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("b/c.tar.gz", trimPrefixPattern("a/b/c.tar.gz", "*/", false), "shortest prefix should be removed")
+	assert.Equal("c.tar.gz", trimPrefixPattern("a/b/c.tar.gz", "*/", true), "longest prefix should be removed")
+	assert.Equal("a/b/c.tar", trimSuffixPattern("a/b/c.tar.gz", ".*", false), "shortest suffix should be removed")
+	assert.Equal("a/b/c", trimSuffixPattern("a/b/c.tar.gz", ".*", true), "longest suffix should be removed")
+	assert.Equal("abc", trimPrefixPattern("abc", "x*", false), "unmatched prefix should not be removed")
+	assert.Equal("abc", trimSuffixPattern("abc", "*x", true), "unmatched suffix should not be removed")
+	assert.Equal("é", trimSuffixPattern("éé", "?", false), "characters should not be split")
+}
@@ -0,0 +1,366 @@
+package nutcracker
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Printer quoting styles
+const (
+	// QuoteMinimal quotes text only where necessary, and preserves the
+	// structure of the syntax tree, such that Parse(Print(n)) is structurally
+	// equal to a parsed script n.
+	QuoteMinimal = iota
+	// QuoteAlways single quotes all unquoted text, which preserves the
+	// semantics but not the structure of the syntax tree.
+	QuoteAlways
+)
+
+type (
+	// Printer prints a syntax tree as shell source
+	Printer struct {
+		Quote int
+		// brace is set within the words of a brace expansion
+		brace bool
+	}
+)
+
+// Print prints a syntax tree as shell source with minimal quoting
+func Print(n Syntax) string {
+	return Printer{}.Print(n)
+}
+
+// Print prints a syntax tree as shell source
+func (p Printer) Print(n Syntax) string {
+	b := strings.Builder{}
+	p.print(&b, n)
+	return b.String()
+}
+
+func (p Printer) print(b *strings.Builder, n Syntax) {
+	switch k := n.(type) {
+	case *Script:
+		for n, i := range k.Lists {
+			if n > 0 {
+				b.WriteString("; ")
+			}
+			p.print(b, i)
+		}
+	case *AndOr:
+		for n, i := range k.Pipes {
+			if n > 0 {
+				if k.Ops[n-1] == OpAnd {
+					b.WriteString(" && ")
+				} else {
+					b.WriteString(" || ")
+				}
+			}
+			p.print(b, i)
+		}
+	case *Pipeline:
+		for n, i := range k.Cmds {
+			if n > 0 {
+				b.WriteString(" | ")
+			}
+			p.print(b, i)
+		}
+	case *Cmd:
+		first := true
+		for _, i := range k.Assigns {
+			if first {
+				first = false
+			} else {
+				b.WriteByte(' ')
+			}
+			p.print(b, i)
+		}
+		for n, i := range k.Args {
+			if first {
+				first = false
+			} else {
+				b.WriteByte(' ')
+			}
+			if n == 0 {
+				p.printCmdName(b, i)
+			} else {
+				p.print(b, i)
+			}
+		}
+		for _, i := range k.Redirs {
+			if first {
+				first = false
+			} else {
+				b.WriteByte(' ')
+			}
+			p.print(b, i)
+		}
+	case *Assign:
+		b.WriteString(k.Name)
+		b.WriteByte('=')
+		if len(k.Value.Nodes) > 0 {
+			p.print(b, k.Value)
+		}
+	case *Redirect:
+		p.printRedirect(b, k)
+	case *Arg:
+		if len(k.Nodes) == 0 {
+			b.WriteString("''")
+			return
+		}
+		p.printNodes(b, k.Nodes, false)
+	case *Text:
+		p.printNodes(b, []Node{k}, false)
+	case *Glob:
+		b.WriteString(k.Pattern)
+	case *StrL:
+		b.WriteString(quoteStrL(k.Text))
+	case *StrI:
+		b.WriteByte('"')
+		p.printNodes(b, k.Nodes, true)
+		b.WriteByte('"')
+	case *EnvVar:
+		p.printEnvVar(b, k, false)
+	case *VarAssign:
+		p.printVarOp(b, k.Name, varOpStr("=", k.Unset), k.Word)
+	case *VarCheck:
+		p.printVarRawOp(b, k.Name, varOpStr("?", k.Unset), k.Word)
+	case *VarAlt:
+		p.printVarOp(b, k.Name, varOpStr("+", k.Unset), k.Word)
+	case *VarLen:
+		b.WriteString("${#")
+		b.WriteString(k.Name)
+		b.WriteByte('}')
+	case *VarTrimPrefix:
+		// quoting unquoted text of a pattern would match it literally
+		p := Printer{}
+		if k.Longest {
+			p.printVarRawOp(b, k.Name, "##", k.Pattern)
+		} else {
+			p.printVarRawOp(b, k.Name, "#", k.Pattern)
+		}
+	case *VarTrimSuffix:
+		p := Printer{}
+		if k.Longest {
+			p.printVarRawOp(b, k.Name, "%%", k.Pattern)
+		} else {
+			p.printVarRawOp(b, k.Name, "%", k.Pattern)
+		}
+	case *Brace:
+		p := p
+		p.brace = true
+		b.WriteByte('{')
+		for n, i := range k.Words {
+			if n > 0 {
+				b.WriteByte(',')
+			}
+			p.printNodes(b, i.Nodes, false)
+		}
+		b.WriteByte('}')
+	case *BraceSeq:
+		b.WriteString(k.text())
+	case *Tilde:
+		b.WriteByte('~')
+		b.WriteString(k.User)
+	case *Arith:
+		b.WriteString("$((")
+		for n, i := range k.Nodes {
+			switch v := i.(type) {
+			case *Text:
+				// the text of an arithmetic expansion is not unescaped
+				b.WriteString(v.Text)
+			case *EnvVar:
+				p.printEnvVar(b, v, continuesName(k.Nodes, n))
+			default:
+				p.print(b, i)
+			}
+		}
+		b.WriteString("))")
+	case *CmdSub:
+		b.WriteString("$(")
+		p.print(b, k.Script)
+		b.WriteByte(')')
+	}
+}
+
+// printNodes prints adjacent nodes, which are within a double quoted string
+// if strI is true
+func (p Printer) printNodes(b *strings.Builder, nodes []Node, strI bool) {
+	for n, i := range nodes {
+		switch k := i.(type) {
+		case *Text:
+			if strI {
+				b.WriteString(escapeStrI(k.Text))
+			} else if p.Quote == QuoteAlways {
+				b.WriteString(quoteStrL(k.Text))
+			} else if p.brace {
+				b.WriteString(strings.ReplaceAll(escapeArg(k.Text), ",", `\,`))
+			} else {
+				b.WriteString(escapeArg(k.Text))
+			}
+		case *EnvVar:
+			p.printEnvVar(b, k, continuesName(nodes, n))
+		case *Glob:
+			// quoting a pattern would match it literally
+			b.WriteString(k.Pattern)
+		default:
+			p.print(b, i)
+		}
+	}
+}
+
+// continuesName reports whether the node following nodes[n] is text which
+// would otherwise continue the name of a variable, such that the variable
+// must be delimited by braces
+func continuesName(nodes []Node, n int) bool {
+	if n+1 >= len(nodes) {
+		return false
+	}
+	t, ok := nodes[n+1].(*Text)
+	return ok && parseTopEnvVar("a"+t.Text) > 1
+}
+
+func (p Printer) printEnvVar(b *strings.Builder, n *EnvVar, braces bool) {
+	// positional parameters of more than one digit must be delimited by braces
+	if len(n.Name) > 1 && isDigit(n.Name[0]) {
+		braces = true
+	}
+	if n.Default == nil && !braces {
+		b.WriteByte('$')
+		b.WriteString(n.Name)
+		return
+	}
+	if n.Default == nil {
+		p.printVarOp(b, n.Name, "", nil)
+		return
+	}
+	p.printVarOp(b, n.Name, varOpStr("-", n.Unset), n.Default)
+}
+
+// varOpStr returns the parameter expansion operator op, prefixed with ':'
+// unless the operator tests only whether the variable is unset
+func varOpStr(op string, unset bool) string {
+	if unset {
+		return op
+	}
+	return ":" + op
+}
+
+// printVarOp prints a parameter expansion with the operator op and word
+func (p Printer) printVarOp(b *strings.Builder, name string, op string, word []*Arg) {
+	b.WriteString("${")
+	b.WriteString(name)
+	b.WriteString(op)
+	for n, i := range word {
+		if n > 0 {
+			b.WriteByte(' ')
+		}
+		p.print(b, i)
+	}
+	b.WriteByte('}')
+}
+
+// printVarRawOp prints a parameter expansion with the operator op and a word
+// which is parsed as a single arg, such that whitespace is printed as is
+func (p Printer) printVarRawOp(b *strings.Builder, name string, op string, word []*Arg) {
+	b.WriteString("${")
+	b.WriteString(name)
+	b.WriteString(op)
+	for n, i := range word {
+		if n > 0 {
+			b.WriteByte(' ')
+		}
+		start := 0
+		for k, j := range i.Nodes {
+			if t, ok := j.(*Text); ok && len(t.Text) > 0 && len(trimLSpace(t.Text)) == 0 {
+				p.printNodes(b, i.Nodes[start:k], false)
+				b.WriteString(t.Text)
+				start = k + 1
+			}
+		}
+		p.printNodes(b, i.Nodes[start:], false)
+	}
+	b.WriteByte('}')
+}
+
+// printCmdName prints the first arg of a command, escaping text which would
+// otherwise be parsed as an assignment
+func (p Printer) printCmdName(b *strings.Builder, n *Arg) {
+	if len(n.Nodes) > 0 && p.Quote == QuoteMinimal {
+		if t, ok := n.Nodes[0].(*Text); ok {
+			if k := len(regexFindAssign.FindString(t.Text)); k > 0 {
+				b.WriteString(escapeArg(t.Text[0 : k-1]))
+				b.WriteString(`\=`)
+				p.printNodes(b, append([]Node{newText(t.Text[k:])}, n.Nodes[1:]...), false)
+				return
+			}
+		}
+	}
+	p.print(b, n)
+}
+
+func (p Printer) printRedirect(b *strings.Builder, n *Redirect) {
+	switch n.Op {
+	case RedirIn:
+		if n.Fd != 0 {
+			b.WriteString(strconv.Itoa(n.Fd))
+		}
+		b.WriteString("<")
+	case RedirAll:
+		b.WriteString("&>")
+	case RedirAllAppend:
+		b.WriteString("&>>")
+	default:
+		if n.Fd != 1 {
+			b.WriteString(strconv.Itoa(n.Fd))
+		}
+		switch n.Op {
+		case RedirOut:
+			b.WriteString(">")
+		case RedirAppend:
+			b.WriteString(">>")
+		case RedirDup:
+			b.WriteString(">&")
+		}
+	}
+	p.print(b, n.Target)
+}
+
+// escapeArg escapes unquoted text such that it is parsed as a single text
+// node
+func escapeArg(text string) string {
+	s := strings.Builder{}
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		if isNewline(ch) {
+			// an escaped newline is removed, and so must be quoted instead
+			s.WriteString("'\n'")
+			continue
+		}
+		if isSpace(ch) || isOperator(ch) || isSpecialArg(ch) || isGlobChar(ch) {
+			s.WriteByte('\\')
+		} else if ch == '~' && (i == 0 || text[i-1] == ':') {
+			// a tilde prefix begins a word, or follows ':' in an assignment
+			s.WriteByte('\\')
+		}
+		s.WriteByte(ch)
+	}
+	return s.String()
+}
+
+// escapeStrI escapes text within a double quoted string
+func escapeStrI(text string) string {
+	s := strings.Builder{}
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		if ch == '$' || ch == '`' || ch == '"' || ch == '\\' {
+			s.WriteByte('\\')
+		}
+		s.WriteByte(ch)
+	}
+	return s.String()
+}
+
+// quoteStrL single quotes text
+func quoteStrL(text string) string {
+	return "'" + strings.Replace(text, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,68 @@
+package nutcracker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Print(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, i := range []struct {
+		arg string
+		out string
+	}{
+		{`echo hello world`, `echo hello world`},
+		{`  echo   hello\ world  `, `echo hello\ world`},
+		{`echo 'hello world' "a $b ${c}d ${e:-  f  $(g)} \$\"\\"`, `echo 'hello world' "a $b ${c}d ${e:-f $(g)} \$\"\\"`},
+		{`echo $a\b ${a}b $a\ b ${a}_ $a"b"`, `echo ${a}b ${a}b $a\ b ${a}_ $a"b"`},
+		{`echo \|\&\;\<\>\(\)\{\}\'\"\$\\`, `echo \|\&\;\<\>\(\)\{\}\'\"\$\\`},
+		{`a | b && c || d; e
+f`, `a | b && c || d; e; f`},
+		{`cmd <in >out 2>>err 2>&1 &>all &>>all 0>x 1<y`, `cmd <in >out 2>>err 2>&1 &>all &>>all 0>x 1<y`},
+		{`> out`, `>out`},
+		{`echo $(a | b; c) $()`, `echo $(a | b; c) $()`},
+		{`echo ${a:-} ${a:-"b c" d}`, `echo ${a:-} ${a:-"b c" d}`},
+		{`echo ${a-b} ${a=b} ${a:=b} ${a?} ${a:?b c} ${a+b} ${a:+b} ${#a}`, `echo ${a-b} ${a=b} ${a:=b} ${a?} ${a:?b c} ${a+b} ${a:+b} ${#a}`},
+		{`echo ${a#*/} ${a##*/} ${a%.*} ${a%%"."*}`, `echo ${a#*/} ${a##*/} ${a%.*} ${a%%"."*}`},
+		{`echo $0 $1 ${10} ${1}0 "$@" $* $# $? $$ ${#} ${#1} ${@:-a}`, `echo $0 $1 ${10} ${1}0 "$@" $* $# $? $$ $# ${#1} ${@:-a}`},
+		{`cp a{b,c}d {1..10..2} {a..e} {,x} {a,{b,c}} {"a b",c\,d} {$a,*.go} x{y} } {a, b}`, `cp a{b,c}d {1..10..2} {a..e} {,x} {a,{b,c}} {"a b",c\,d} {$a,*.go} x\{y\} \} \{a, b\}`},
+		{`A=~/a:~b:\~:x\~ cat ~ ~/a ~b/c \~ "~" a~ ${a:-~}`, `A=~/a:~b:\~:x~ cat ~ ~/a ~b/c \~ "~" a~ ${a:-~}`},
+		{`echo \*.go \[a] *.go [a] a\? "*"`, `echo \*.go \[a\] *.go [a] a\? "*"`},
+		{`echo $((a\\b)) $((\$a + $b_ + ${c}d)) "$((a\\b))"`, `echo $((a\\b)) $((\$a + $b_ + ${c}d)) "$((a\\b))"`},
+		{`echo ${a% *} "${a#*  }" ${a:? missing\ a  $b} ${a%%\ }`, `echo ${a% *} "${a#*  }" ${a:? missing\ a  $b} ${a%% }`},
+		{`echo $((1+2)) $(( (a + $b) * "${c}" ))x $(($(echo 1)+2))`, `echo $((1+2)) $(( (a + $b) * "$c" ))x $(($(echo 1)+2))`},
+		{"echo `a \\`b\\`` \"`c`\\`\" \\`", "echo $(a $(b)) \"$(c)\\`\" \\`"},
+		{``, ``},
+	} {
+		n, err := Parse(i.arg)
+		assert.NoError(err, "Parse should not error")
+		out := Print(n)
+		assert.Equal(i.out, out, "Print should output canonical source")
+		k, err := Parse(out)
+		assert.NoError(err, "printed source should parse")
+		assert.Equal(stripSpan(n), stripSpan(k), "printed source should parse to the same syntax tree")
+		assert.Equal(out, Print(k), "printed source should print the same")
+	}
+
+	{
+		n, err := Parse(`echo hello\ world "$a b" 'c'd ${e:-f g}`)
+		assert.NoError(err, "Parse should not error")
+		assert.Equal(`'echo' 'hello world' "$a b" 'c''d' ${e:-'f' 'g'}`, Printer{Quote: QuoteAlways}.Print(n), "Print should quote all text")
+	}
+	{
+		n, err := Parse(`echo ${a%.*}`)
+		assert.NoError(err, "Parse should not error")
+		assert.Equal(`'echo' ${a%.*}`, Printer{Quote: QuoteAlways}.Print(n), "Print should not quote patterns")
+	}
+	{
+		n := newCmd([]*Arg{
+			newArg([]Node{newText("echo")}),
+			newArg([]Node{newStrL("it's")}),
+			newArg([]Node{newText("a\nb")}),
+			newArg([]Node{}),
+		}, []*Redirect{})
+		assert.Equal(`echo 'it'\''s' a'
+'b ''`, Print(n), "Print should preserve the semantics of text which cannot be parsed")
+	}
+}
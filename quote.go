@@ -0,0 +1,44 @@
+package nutcracker
+
+import (
+	"strings"
+)
+
+// isSafeArg reports whether c may appear unquoted in an argument without
+// being interpreted by the parser
+func isSafeArg(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	switch c {
+	case '-', '_', '.', '/', ',', ':', '@', '%', '+':
+		return true
+	default:
+		return false
+	}
+}
+
+// Quote returns s quoted such that it is parsed as a single argument with the
+// literal value s
+func Quote(s string) string {
+	if len(s) == 0 {
+		return "''"
+	}
+	for i := 0; i < len(s); i++ {
+		if !isSafeArg(s[i]) {
+			return quoteStrL(s)
+		}
+	}
+	return s
+}
+
+// Join quotes each argument and joins them with spaces, such that the result
+// is parsed as a command with the literal arguments args
+func Join(args []string) string {
+	k := make([]string, 0, len(args))
+	for _, i := range args {
+		k = append(k, Quote(i))
+	}
+	return strings.Join(k, " ")
+}
@@ -0,0 +1,88 @@
+package nutcracker
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"testing/quick"
+)
+
+func Test_Quote(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("hello", Quote("hello"), "safe text should not be quoted")
+	assert.Equal("a-b_c.d/e,f:g@h%i+j", Quote("a-b_c.d/e,f:g@h%i+j"), "safe text should not be quoted")
+	assert.Equal("''", Quote(""), "empty text should be quoted")
+	assert.Equal("'hello world'", Quote("hello world"), "text with spaces should be quoted")
+	assert.Equal(`'$HOME'`, Quote("$HOME"), "variables should be quoted")
+	assert.Equal(`'it'\''s'`, Quote("it's"), "single quotes should be escaped")
+	assert.Equal(`'FOO=bar'`, Quote("FOO=bar"), "assignments should be quoted")
+	assert.Equal(`'*.go'`, Quote("*.go"), "patterns should be quoted")
+	assert.Equal(`'~'`, Quote("~"), "tilde should be quoted")
+}
+
+func Test_Join(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(`echo 'hello world' '$(rm -rf /)' '' 'a;b'`, Join([]string{"echo", "hello world", "$(rm -rf /)", "", "a;b"}), "each argument should be quoted")
+	assert.Equal("", Join([]string{}), "empty args should be joined to empty text")
+}
+
+// parseLiteralArgs parses a command and returns the literal values of its
+// arguments
+func parseLiteralArgs(s string) ([]string, bool) {
+	n, err := Parse(s)
+	if err != nil {
+		return nil, false
+	}
+	if len(n.Lists) != 1 || len(n.Lists[0].Pipes) != 1 || len(n.Lists[0].Pipes[0].Cmds) != 1 {
+		return nil, false
+	}
+	cmd := n.Lists[0].Pipes[0].Cmds[0]
+	if len(cmd.Redirs) != 0 {
+		return nil, false
+	}
+	args := make([]string, 0, len(cmd.Args))
+	for _, i := range cmd.Args {
+		v, ok := i.Literal()
+		if !ok {
+			return nil, false
+		}
+		k, err := i.Value(context.Background(), Env{})
+		if err != nil || k != v {
+			return nil, false
+		}
+		args = append(args, v)
+	}
+	return args, true
+}
+
+func Test_Quote_Property(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(quick.Check(func(s string) bool {
+		args, ok := parseLiteralArgs(Quote(s))
+		return ok && len(args) == 1 && args[0] == s
+	}, &quick.Config{MaxCount: 2000}), "quoted text should be parsed as a single literal argument")
+
+	assert.NoError(quick.Check(func(s []byte) bool {
+		args, ok := parseLiteralArgs(Quote(string(s)))
+		return ok && len(args) == 1 && args[0] == string(s)
+	}, &quick.Config{MaxCount: 2000}), "quoted bytes should be parsed as a single literal argument")
+
+	assert.NoError(quick.Check(func(s []string) bool {
+		if len(s) == 0 {
+			return true
+		}
+		args, ok := parseLiteralArgs(Join(s))
+		if !ok || len(args) != len(s) {
+			return false
+		}
+		for n, i := range s {
+			if args[n] != i {
+				return false
+			}
+		}
+		return true
+	}, &quick.Config{MaxCount: 1000}), "joined args should be parsed as the literal arguments")
+}
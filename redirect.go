@@ -0,0 +1,170 @@
+package nutcracker
+
+import (
+	"context"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// Redirect operators
+const (
+	RedirIn = iota
+	RedirOut
+	RedirAppend
+	RedirDup
+	RedirAll
+	RedirAllAppend
+)
+
+type (
+	// Redirect redirects the file descriptor Fd of a command to or from
+	// Target, where Op is one of the Redir constants
+	Redirect struct {
+		span
+		Op     int
+		Fd     int
+		Target *Arg
+	}
+)
+
+func newRedirect(op int, fd int, target *Arg) *Redirect {
+	return &Redirect{
+		Op:     op,
+		Fd:     fd,
+		Target: target,
+	}
+}
+
+// apply evaluates the target of the redirect and rewires the stdio of env.
+// Relative paths are resolved against env.Dir. Files opened by the redirect
+// are appended to files, and must be closed by the caller once the command
+// has completed.
+func (r Redirect) apply(ctx context.Context, env *Env, files *[]*os.File) error {
+	target, err := r.Target.Value(ctx, *env)
+	if err != nil {
+		return err
+	}
+	switch r.Op {
+	case RedirIn:
+		f, err := os.Open(resolvePath(*env, target))
+		if err != nil {
+			return err
+		}
+		*files = append(*files, f)
+		return setStdio(env, r.Fd, f)
+	case RedirOut, RedirAppend, RedirAll, RedirAllAppend:
+		flag := os.O_WRONLY | os.O_CREATE
+		if r.Op == RedirAppend || r.Op == RedirAllAppend {
+			flag |= os.O_APPEND
+		} else {
+			flag |= os.O_TRUNC
+		}
+		f, err := os.OpenFile(resolvePath(*env, target), flag, 0666)
+		if err != nil {
+			return err
+		}
+		*files = append(*files, f)
+		if r.Op == RedirAll || r.Op == RedirAllAppend {
+			env.Stdout = f
+			env.Stderr = f
+			return nil
+		}
+		return setStdio(env, r.Fd, f)
+	case RedirDup:
+		fd, err := strconv.Atoi(target)
+		if err != nil {
+			return ErrInvalidRedirect
+		}
+		switch fd {
+		case 1:
+			return setStdio(env, r.Fd, env.Stdout)
+		case 2:
+			return setStdio(env, r.Fd, env.Stderr)
+		default:
+			return ErrInvalidRedirect
+		}
+	default:
+		return ErrInvalidRedirect
+	}
+}
+
+// setStdio sets the stdio stream of env with file descriptor fd to s
+func setStdio(env *Env, fd int, s interface{}) error {
+	switch fd {
+	case 0:
+		r, ok := s.(io.Reader)
+		if !ok {
+			return ErrInvalidRedirect
+		}
+		env.Stdin = r
+	case 1, 2:
+		w, ok := s.(io.Writer)
+		if !ok {
+			return ErrInvalidRedirect
+		}
+		if fd == 1 {
+			env.Stdout = w
+		} else {
+			env.Stderr = w
+		}
+	default:
+		return ErrInvalidRedirect
+	}
+	return nil
+}
+
+var (
+	regexFindRedir = regexp.MustCompile(`^(?:([0-9]*)(>>|>&|>|<)|(&>>|&>))`)
+)
+
+// parseRedirect parses a redirect if one exists at the beginning of the
+// text. The returned redirect is nil if the text does not begin with a
+// redirect operator.
+// takes in a string not beginning with whitespace
+func (p *parser) parseRedirect(text string, mode int) (*Redirect, string, error) {
+	m := regexFindRedir.FindStringSubmatch(text)
+	if m == nil {
+		return nil, text, nil
+	}
+	start := text
+	text = trimLBlank(text[len(m[0]):])
+	op := 0
+	fd := 1
+	switch m[2] {
+	case "<":
+		op = RedirIn
+		fd = 0
+	case ">":
+		op = RedirOut
+	case ">>":
+		op = RedirAppend
+	case ">&":
+		op = RedirDup
+	default:
+		switch m[3] {
+		case "&>":
+			op = RedirAll
+		case "&>>":
+			op = RedirAllAppend
+		}
+	}
+	if len(m[1]) > 0 {
+		k, err := strconv.Atoi(m[1])
+		if err != nil || k > 2 {
+			return nil, "", p.err(start, ErrInvalidRedirect)
+		}
+		fd = k
+	}
+	if len(text) == 0 || isOperator(text[0]) || isNewline(text[0]) || text[0] == ')' && mode == argModeCmd {
+		return nil, "", p.err(start, ErrInvalidRedirect)
+	}
+	target, next, err := p.parseArg(text, mode)
+	if err != nil {
+		return nil, "", err
+	}
+	r := newRedirect(op, fd, target)
+	r.setSpan(p.pos(start), target.End())
+	return r, next, nil
+}
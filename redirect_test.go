@@ -0,0 +1,196 @@
+package nutcracker
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_parseRedirect(t *testing.T) {
+	assert := assert.New(t)
+
+	{
+		arg := `> out.txt hello`
+		r, next, err := newParser(arg).parseRedirect(arg, argModeNorm)
+		assert.NoError(err, "parse Redirect should not error")
+		assert.Equal("hello", next, "only the Redirect should be parsed")
+		assert.Equal(newRedirect(RedirOut, 1, newArg([]Node{newText("out.txt")})), stripSpan(r), "Redirect should be parsed")
+	}
+	{
+		arg := `2>>"$dir/log"`
+		r, next, err := newParser(arg).parseRedirect(arg, argModeNorm)
+		assert.NoError(err, "parse Redirect should not error")
+		assert.Equal("", next, "only the Redirect should be parsed")
+		assert.Equal(newRedirect(RedirAppend, 2, newArg([]Node{newStrI([]Node{newEnvVar("dir", nil), newText("/log")})})), stripSpan(r), "Redirect target should be an arg")
+	}
+	{
+		arg := `2>&1`
+		r, _, err := newParser(arg).parseRedirect(arg, argModeNorm)
+		assert.NoError(err, "parse Redirect should not error")
+		assert.Equal(newRedirect(RedirDup, 2, newArg([]Node{newText("1")})), stripSpan(r), "Redirect should be parsed")
+	}
+	{
+		arg := `<in.txt`
+		r, _, err := newParser(arg).parseRedirect(arg, argModeNorm)
+		assert.NoError(err, "parse Redirect should not error")
+		assert.Equal(newRedirect(RedirIn, 0, newArg([]Node{newText("in.txt")})), stripSpan(r), "Redirect should be parsed")
+	}
+	{
+		arg := `&>all.txt`
+		r, _, err := newParser(arg).parseRedirect(arg, argModeNorm)
+		assert.NoError(err, "parse Redirect should not error")
+		assert.Equal(newRedirect(RedirAll, 1, newArg([]Node{newText("all.txt")})), stripSpan(r), "Redirect should be parsed")
+	}
+	{
+		arg := `hello > out.txt`
+		r, next, err := newParser(arg).parseRedirect(arg, argModeNorm)
+		assert.NoError(err, "parse Redirect should not error")
+		assert.Nil(r, "text not beginning with a Redirect should not be parsed")
+		assert.Equal(arg, next, "text not beginning with a Redirect should not be consumed")
+	}
+	{
+		arg := `> | cat`
+		_, _, err := newParser(arg).parseRedirect(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrInvalidRedirect), "parse Redirect should error on missing target")
+	}
+	{
+		arg := `>`
+		_, _, err := newParser(arg).parseRedirect(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrInvalidRedirect), "parse Redirect should error on missing target")
+	}
+	{
+		arg := `3> out.txt`
+		_, _, err := newParser(arg).parseRedirect(arg, argModeNorm)
+		assert.True(errors.Is(err, ErrInvalidRedirect), "parse Redirect should error on unsupported file descriptors")
+	}
+}
+
+func Test_Redirect(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+
+	exec := NewExecutor()
+	envfunc := func(s string) string {
+		if s == "dir" {
+			return dir
+		}
+		return ""
+	}
+	{
+		arg := `echo hello world > "$dir/out.txt"`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Envfunc: envfunc, Ex: exec})
+		assert.NoError(err, "cmd should not error")
+		b, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+		assert.NoError(err, "output file should be created")
+		assert.Equal("hello world\n", string(b), "stdout should be redirected to the file")
+	}
+	{
+		arg := `echo again >>$dir/out.txt`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Envfunc: envfunc, Ex: exec})
+		assert.NoError(err, "cmd should not error")
+		b, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+		assert.NoError(err, "output file should exist")
+		assert.Equal("hello world\nagain\n", string(b), "stdout should be appended to the file")
+	}
+	{
+		b := bytes.Buffer{}
+		arg := `tr a-z A-Z <$dir/out.txt`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Envfunc: envfunc, Ex: exec, Stdout: &b})
+		assert.NoError(err, "cmd should not error")
+		assert.Equal("HELLO WORLD\nAGAIN\n", b.String(), "stdin should be redirected from the file")
+	}
+	{
+		b := bytes.Buffer{}
+		arg := `ls $dir/bogus 2>&1`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		status, err := n.Exec(Env{Envfunc: envfunc, Ex: exec, Stdout: &b})
+		assert.NoError(err, "cmd should not error")
+		assert.False(status.Success(), "cmd should fail")
+		assert.NotEqual("", b.String(), "stderr should be redirected to stdout")
+	}
+	{
+		b := bytes.Buffer{}
+		arg := `ls $dir/bogus >$dir/err.txt 2>&1`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Envfunc: envfunc, Ex: exec, Stdout: &b, Stderr: &b})
+		assert.NoError(err, "cmd should not error")
+		assert.Equal("", b.String(), "redirects should be applied in order")
+		k, err := os.ReadFile(filepath.Join(dir, "err.txt"))
+		assert.NoError(err, "output file should be created")
+		assert.NotEqual("", string(k), "stderr should be redirected to the file")
+	}
+	{
+		arg := `ls $dir $dir/bogus &>$dir/all.txt`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Envfunc: envfunc, Ex: exec})
+		assert.NoError(err, "cmd should not error")
+		k, err := os.ReadFile(filepath.Join(dir, "all.txt"))
+		assert.NoError(err, "output file should be created")
+		assert.Contains(string(k), "out.txt", "stdout should be redirected to the file")
+		assert.Contains(string(k), "bogus", "stderr should be redirected to the file")
+	}
+	{
+		arg := `>$dir/empty.txt`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Envfunc: envfunc, Ex: exec})
+		assert.NoError(err, "Redirect without a command should not error")
+		k, err := os.ReadFile(filepath.Join(dir, "empty.txt"))
+		assert.NoError(err, "output file should be created")
+		assert.Equal("", string(k), "output file should be empty")
+	}
+	{
+		b := bytes.Buffer{}
+		arg := `echo hello 2>&1 | tr a-z A-Z > $dir/pipe.txt`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Envfunc: envfunc, Ex: exec, Stdout: &b})
+		assert.NoError(err, "cmd should not error")
+		assert.Equal("", b.String(), "stdout should be redirected")
+		k, err := os.ReadFile(filepath.Join(dir, "pipe.txt"))
+		assert.NoError(err, "output file should be created")
+		assert.Equal("HELLO\n", string(k), "redirects should apply to pipeline commands")
+	}
+	{
+		arg := `cat < $dir/bogus`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Envfunc: envfunc, Ex: exec})
+		assert.Error(err, "Redirect should error on missing input file")
+	}
+	{
+		arg := `echo hello >&3`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Envfunc: envfunc, Ex: exec})
+		assert.Equal(ErrInvalidRedirect, err, "Redirect should error on unsupported file descriptor")
+	}
+	{
+		arg := `echo relative > rel.txt; cat < rel.txt > copy.txt`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Ex: exec, Dir: dir})
+		assert.NoError(err, "cmd should not error")
+		k, err := os.ReadFile(filepath.Join(dir, "copy.txt"))
+		assert.NoError(err, "output file should be created in the env dir")
+		assert.Equal("relative\n", string(k), "relative redirects should be resolved against the env dir")
+	}
+	{
+		arg := `echo hello & echo world`
+		_, err := Parse(arg)
+		assert.True(errors.Is(err, ErrInvalidOperator), "Parse should error on unsupported operators")
+	}
+}
@@ -0,0 +1,209 @@
+package nutcracker
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+)
+
+type (
+	// Shell is the state of a shell which persists across commands. Vars
+	// holds all shell variables, of which those named in Exports are passed
+	// in the environment of commands. Dir is the working directory of
+	// commands, or the working directory of the process if empty. Args are
+	// the positional parameters, and Status is the status of the last command
+	// list.
+	Shell struct {
+		Base    Env
+		Vars    map[string]string
+		Exports map[string]struct{}
+		Dir     string
+		Args    []string
+		Status  Status
+		// unset holds the variables which have been unset, such that they are
+		// not looked up from Base
+		unset map[string]struct{}
+	}
+)
+
+// NewShell creates a Shell which runs commands with the stdio, executor, and
+// options of base. The variables of base.Envvar are imported into the shell as
+// exported variables. If base.Envvar is nil, variables not set in the shell
+// are looked up from base.Lookup or base.Envfunc, or if both are nil, the
+// variables of the process environment are imported. If base.Builtins is nil,
+// the shell uses DefaultBuiltins.
+func NewShell(base Env) *Shell {
+	environ := base.Envvar
+	if environ == nil && base.Lookup == nil && base.Envfunc == nil {
+		environ = os.Environ()
+	}
+	vars := make(map[string]string, len(environ))
+	exports := make(map[string]struct{}, len(environ))
+	for _, i := range environ {
+		k := strings.IndexByte(i, '=')
+		if k < 0 {
+			continue
+		}
+		vars[i[0:k]] = i[k+1:]
+		exports[i[0:k]] = struct{}{}
+	}
+	if base.Builtins == nil {
+		base.Builtins = DefaultBuiltins()
+	}
+	return &Shell{
+		Base:    base,
+		Vars:    vars,
+		Exports: exports,
+		Dir:     base.Dir,
+		Args:    base.Args,
+	}
+}
+
+// Env returns the Env with which commands are run by the shell
+func (s *Shell) Env() Env {
+	env := s.Base
+	env.Envvar = nil
+	env.Vars = s.Vars
+	env.Dir = s.Dir
+	env.Args = s.Args
+	env.Shell = s
+	return env
+}
+
+// Exec calls ExecContext with a background context
+func (s *Shell) Exec(script *Script) (Status, error) {
+	return s.ExecContext(context.Background(), script)
+}
+
+// ExecContext runs the script in the shell, and records its status
+func (s *Shell) ExecContext(ctx context.Context, script *Script) (Status, error) {
+	status, err := script.ExecContext(ctx, s.Env())
+	if err != nil {
+		return Status{}, err
+	}
+	s.Status = status
+	return status, nil
+}
+
+// Run parses and runs the script in the shell
+func (s *Shell) Run(ctx context.Context, script string) (Status, error) {
+	n, err := Parse(script)
+	if err != nil {
+		return Status{}, err
+	}
+	return s.ExecContext(ctx, n)
+}
+
+// Unset removes a variable from the shell, such that it is also not looked up
+// from Base
+func (s *Shell) Unset(name string) {
+	delete(s.Vars, name)
+	delete(s.Exports, name)
+	if s.unset == nil {
+		s.unset = map[string]struct{}{}
+	}
+	s.unset[name] = struct{}{}
+}
+
+// Export marks a variable to be passed in the environment of commands
+func (s *Shell) Export(name string) {
+	s.Exports[name] = struct{}{}
+}
+
+// Environ returns the environment of commands as NAME=value entries of the
+// exported variables, sorted by name
+func (s *Shell) Environ() []string {
+	env := s.Env()
+	k := make([]string, 0, len(s.Exports))
+	for i := range s.Exports {
+		if v, ok := env.LookupVar(i); ok {
+			k = append(k, i+"="+v)
+		}
+	}
+	sort.Strings(k)
+	return k
+}
+
+// clone returns a copy of the shell which does not share state
+func (s *Shell) clone() *Shell {
+	k := *s
+	k.Vars = make(map[string]string, len(s.Vars))
+	for n, v := range s.Vars {
+		k.Vars[n] = v
+	}
+	k.Exports = make(map[string]struct{}, len(s.Exports))
+	for n := range s.Exports {
+		k.Exports[n] = struct{}{}
+	}
+	k.unset = make(map[string]struct{}, len(s.unset))
+	for n := range s.unset {
+		k.unset[n] = struct{}{}
+	}
+	k.Args = append([]string{}, s.Args...)
+	return &k
+}
+
+// cmdEnv returns env with the working directory and environment of commands
+// from the current state of env.Shell
+func (env Env) cmdEnv() Env {
+	if env.Shell == nil {
+		return env
+	}
+	env.Dir = env.Shell.Dir
+	env.Envvar = env.Shell.Environ()
+	return env
+}
+
+// setStatus records the status of a command list in env.Shell, or otherwise
+// in env.status if set
+func (env Env) setStatus(status Status) {
+	if env.Shell != nil {
+		env.Shell.Status = status
+	} else if env.status != nil {
+		*env.status = status
+	}
+}
+
+// lastStatus returns the status of the last command list
+func (env Env) lastStatus() Status {
+	if env.Shell != nil {
+		return env.Shell.Status
+	}
+	if env.status != nil {
+		return *env.status
+	}
+	return Status{}
+}
+
+// withStatus returns env with a status to record the last status of a
+// command list if it has no shell
+func (env Env) withStatus() Env {
+	if env.Shell == nil && env.status == nil {
+		env.status = &Status{}
+	}
+	return env
+}
+
+// subshell returns env with a copy of its shell state, such that assignments
+// do not affect the parent
+func (env Env) subshell() Env {
+	if env.Shell != nil {
+		env.Shell = env.Shell.clone()
+		env.Vars = env.Shell.Vars
+		return env
+	}
+	if env.status != nil {
+		status := *env.status
+		env.status = &status
+	}
+	if env.Vars == nil {
+		return env
+	}
+	vars := make(map[string]string, len(env.Vars))
+	for k, v := range env.Vars {
+		vars[k] = v
+	}
+	env.Vars = vars
+	return env
+}
@@ -0,0 +1,97 @@
+package nutcracker
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_NewShell(t *testing.T) {
+	assert := assert.New(t)
+
+	{
+		s := NewShell(Env{Envvar: []string{"HOME=/home", "bogus", "PATH=/bin"}})
+		assert.Equal(map[string]string{"HOME": "/home", "PATH": "/bin"}, s.Vars, "envvar should be imported into vars")
+		assert.Equal([]string{"HOME=/home", "PATH=/bin"}, s.Environ(), "envvar should be exported")
+	}
+	{
+		s := NewShell(Env{})
+		assert.Equal(os.Getenv("PATH"), s.Vars["PATH"], "process environment should be imported into vars")
+	}
+}
+
+func Test_Shell(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	{
+		b := bytes.Buffer{}
+		s := NewShell(Env{Envvar: []string{"PATH=" + os.Getenv("PATH"), "HOME=/home"}, Ex: NewExecutor(), Stdout: &b})
+		_, err := s.Run(ctx, "A=1\nB=2")
+		assert.NoError(err, "Run should not error")
+		_, err = s.Run(ctx, `echo $A $B $HOME; sh -c 'echo "$A" "$HOME"'`)
+		assert.NoError(err, "Run should not error")
+		s.Export("A")
+		_, err = s.Run(ctx, `HOME=/root sh -c 'echo "$A" "$HOME"'; sh -c 'echo "$HOME"'`)
+		assert.NoError(err, "Run should not error")
+		assert.Equal("1 2 /home\n /home\n1 /root\n/home\n", b.String(), "variables should persist across runs, and only exported variables should be passed to commands")
+		assert.Equal(map[string]string{"PATH": os.Getenv("PATH"), "HOME": "/home", "A": "1", "B": "2"}, s.Vars, "variables should be set in the shell")
+	}
+	{
+		s := NewShell(Env{Envvar: []string{"PATH=" + os.Getenv("PATH")}, Ex: NewExecutor()})
+		status, err := s.Run(ctx, `false`)
+		assert.NoError(err, "Run should not error")
+		assert.False(status.Success(), "status should be returned")
+		assert.Equal(status, s.Status, "status should be recorded")
+		_, err = s.Run(ctx, `false || true`)
+		assert.NoError(err, "Run should not error")
+		assert.True(s.Status.Success(), "status of the last command should be recorded")
+	}
+	{
+		b := bytes.Buffer{}
+		s := NewShell(Env{Envvar: []string{"PATH=" + os.Getenv("PATH")}, Ex: NewExecutor(), Stdout: &b})
+		_, err := s.Run(ctx, `A=1 | cat; echo $(B=2) $A $B`)
+		assert.NoError(err, "Run should not error")
+		assert.Equal("\n", b.String(), "subshells should not affect the shell")
+		_, ok := s.Vars["A"]
+		assert.False(ok, "assignments in subshells should not be set in the shell")
+	}
+	{
+		b := bytes.Buffer{}
+		s := NewShell(Env{Envvar: []string{"PATH=" + os.Getenv("PATH")}, Ex: NewExecutor(), Stdout: &b})
+		status, err := s.Run(ctx, `x=$(exit 5); echo $?; out=$(echo a; false) || echo "handled $out"; y=$(false)$(true)`)
+		assert.NoError(err, "failed command substitutions should not error")
+		assert.Equal("5\nhandled a\n", b.String(), "the status of command substitutions should be recorded")
+		assert.True(status.Success(), "the status of an assignment should be that of its last command substitution")
+	}
+	{
+		b := bytes.Buffer{}
+		lookup := func(name string) (string, bool) {
+			if name == "X" {
+				return "lookup", true
+			}
+			return "", false
+		}
+		s := NewShell(Env{Lookup: lookup, Stdout: &b})
+		assert.Equal(map[string]string{}, s.Vars, "the process environment should not be imported with a lookup")
+		n, err := Parse(`echo $X; X=2; echo $X; unset X; echo "${X-unset}"`)
+		assert.NoError(err, "Parse should not error")
+		_, err = s.Exec(n)
+		assert.NoError(err, "Exec should not error")
+		assert.Equal("lookup\n2\nunset\n", b.String(), "unset variables should not be looked up from the base env")
+	}
+	{
+		dir := t.TempDir()
+		assert.NoError(os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello\n"), 0644), "file should be created")
+
+		b := bytes.Buffer{}
+		s := NewShell(Env{Envvar: []string{"PATH=" + os.Getenv("PATH")}, Ex: NewExecutor(), Stdout: &b})
+		s.Dir = dir
+		_, err := s.Run(ctx, `cat file.txt`)
+		assert.NoError(err, "Run should not error")
+		assert.Equal("hello\n", b.String(), "commands should run in the shell dir")
+	}
+}
@@ -0,0 +1,77 @@
+package nutcracker
+
+import (
+	"context"
+	"strings"
+)
+
+type (
+	// Splitter splits text into words without evaluating it
+	Splitter struct {
+		// Literal leaves variables and command substitutions as their source
+		// text instead of returning an error
+		Literal bool
+	}
+)
+
+// Split splits text into words the way Parse would split the arguments of a
+// command, returning a *ParseError wrapping ErrInvalidExpansion if text
+// contains a variable or command substitution
+func Split(text string) ([]string, error) {
+	return Splitter{}.Split(text)
+}
+
+// Split splits text into words the way Parse would split the arguments of a
+// command. Quotes and escapes are removed, and newlines separate words. A
+// *ParseError is returned if text contains an operator, or a variable or
+// command substitution and s.Literal is not set.
+func (s Splitter) Split(text string) ([]string, error) {
+	p := newParser(text)
+	words := []string{}
+	for {
+		text = trimLSpace(text)
+		if len(text) == 0 {
+			return words, nil
+		}
+		n, next, err := p.parseArg(text, argModeNorm)
+		if err != nil {
+			return nil, err
+		}
+		if next == text {
+			return nil, p.err(text, ErrInvalidOperator)
+		}
+		k := strings.Builder{}
+		if err := s.writeNodes(p, &k, flattenBraces(n.Nodes)); err != nil {
+			return nil, err
+		}
+		words = append(words, k.String())
+		text = next
+	}
+}
+
+func (s Splitter) writeNodes(p *parser, b *strings.Builder, nodes []Node) error {
+	for _, i := range nodes {
+		switch k := i.(type) {
+		case *Text:
+			b.WriteString(k.Text)
+		case *StrL:
+			b.WriteString(k.Text)
+		case *Glob:
+			v, _ := k.Value(context.Background(), Env{})
+			b.WriteString(v)
+		case *Tilde:
+			b.WriteByte('~')
+			b.WriteString(k.User)
+		case *StrI:
+			if err := s.writeNodes(p, b, k.Nodes); err != nil {
+				return err
+			}
+		default:
+			if !s.Literal {
+				return p.err(p.src[i.Pos().Offset:], ErrInvalidExpansion)
+			}
+			b.WriteString(p.src[i.Pos().Offset:i.End().Offset])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package nutcracker
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Split(t *testing.T) {
+	assert := assert.New(t)
+
+	{
+		words, err := Split(`echo  "hello world" 'it''s' a\ b`)
+		assert.NoError(err, "Split should not error")
+		assert.Equal([]string{"echo", "hello world", "its", "a b"}, words, "text should be split into words")
+	}
+	{
+		words, err := Split("one\n\ttwo  ''\n")
+		assert.NoError(err, "Split should not error")
+		assert.Equal([]string{"one", "two", ""}, words, "newlines should separate words")
+	}
+	{
+		words, err := Split("   ")
+		assert.NoError(err, "Split should not error")
+		assert.Equal([]string{}, words, "blank text should have no words")
+	}
+	{
+		words, err := Split(Join([]string{"a b", "$c", "it's", ""}))
+		assert.NoError(err, "Split should not error")
+		assert.Equal([]string{"a b", "$c", "it's", ""}, words, "Split should undo Join")
+	}
+	{
+		_, err := Split(`echo "hello $name"`)
+		assert.True(errors.Is(err, ErrInvalidExpansion), "Split should error on variables")
+		var perr *ParseError
+		assert.True(errors.As(err, &perr), "Split should return a parse error")
+		assert.Equal(Pos{Offset: 12, Line: 1, Col: 13}, perr.Pos, "error should be located at the variable")
+	}
+	{
+		words, err := Split(`cp file.{txt,bak} {1..3} {} }`)
+		assert.NoError(err, "Split should not error")
+		assert.Equal([]string{"cp", "file.{txt,bak}", "{1..3}", "{}", "}"}, words, "braces should be literal")
+	}
+	{
+		words, err := Split(`ls ~ ~kevin/a`)
+		assert.NoError(err, "Split should not error")
+		assert.Equal([]string{"ls", "~", "~kevin/a"}, words, "tilde prefixes should be literal")
+	}
+	{
+		_, err := Split(`echo $(ls)`)
+		assert.True(errors.Is(err, ErrInvalidExpansion), "Split should error on command substitution")
+		_, err = Split(`echo $((1 + 2))`)
+		assert.True(errors.Is(err, ErrInvalidExpansion), "Split should error on arithmetic expansion")
+	}
+	{
+		_, err := Split(`echo a | cat`)
+		assert.True(errors.Is(err, ErrInvalidOperator), "Split should error on operators")
+	}
+	{
+		_, err := Split(`echo "hello`)
+		assert.True(errors.Is(err, ErrUnclosedStrI), "Split should error on unclosed quotes")
+	}
+	{
+		words, err := Splitter{Literal: true}.Split(`echo "hello $name" ${a:-b c}x $(ls -l)`)
+		assert.NoError(err, "Split should not error")
+		assert.Equal([]string{"echo", "hello $name", "${a:-b c}x", "$(ls -l)"}, words, "expansions should be left as source text")
+	}
+	{
+		words, err := Splitter{Literal: true}.Split("echo `ls \\`pwd\\``x \"a `b`\"")
+		assert.NoError(err, "Split should not error")
+		assert.Equal([]string{"echo", "`ls \\`pwd\\``x", "a `b`"}, words, "backquotes should be left as source text")
+	}
+}
@@ -0,0 +1,84 @@
+package nutcracker
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"regexp"
+)
+
+type (
+	// HomeFunc returns the home directory of the user and whether the user
+	// exists, where an empty user is the current user
+	HomeFunc func(user string) (string, bool)
+
+	// Tilde is a tilde prefix of a word, which evaluates to the home directory
+	// of User, or of the current user if User is empty
+	Tilde struct {
+		span
+		User string
+	}
+)
+
+func newTilde(user string) *Tilde {
+	return &Tilde{
+		User: user,
+	}
+}
+
+// Value evaluates the tilde prefix to $HOME if User is empty and HOME is set,
+// and otherwise to the home directory returned by env.Home. The tilde prefix
+// is left as is if the home directory cannot be found.
+func (n Tilde) Value(ctx context.Context, env Env) (string, error) {
+	if len(n.User) == 0 {
+		if v, ok := env.LookupVar("HOME"); ok {
+			return v, nil
+		}
+	}
+	home := env.Home
+	if home == nil {
+		home = lookupHome
+	}
+	if v, ok := home(n.User); ok {
+		return v, nil
+	}
+	return "~" + n.User, nil
+}
+
+// lookupHome returns the home directory of the user from the operating system
+func lookupHome(name string) (string, bool) {
+	if len(name) == 0 {
+		v, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		return v, true
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", false
+	}
+	return u.HomeDir, true
+}
+
+var (
+	regexFindTilde = regexp.MustCompile(`^~[a-zA-Z0-9._-]*`)
+)
+
+// parseTilde parses a tilde prefix, returning a nil node if the text
+// following the user name is not the end of the word, '/', or ':' in an
+// assignment
+// takes in a string beginning with '~'
+func (p *parser) parseTilde(text string, mode int, assign bool) (*Tilde, string) {
+	k := len(regexFindTilde.FindString(text))
+	next := text[k:]
+	if len(next) > 0 {
+		ch := next[0]
+		if !(ch == '/' || isSpace(ch) || ch == ')' || isArgEnd(ch, mode) || isOperator(ch) && mode != argModeVar || ch == ':' && assign) {
+			return nil, text
+		}
+	}
+	n := newTilde(text[1:k])
+	n.setSpan(p.pos(text), p.pos(next))
+	return n, next
+}
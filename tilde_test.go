@@ -0,0 +1,88 @@
+package nutcracker
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_parseTilde(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, i := range []struct {
+		arg   string
+		nodes []Node
+	}{
+		{arg: `~`, nodes: []Node{newTilde("")}},
+		{arg: `~/a/b`, nodes: []Node{newTilde(""), newText("/a/b")}},
+		{arg: `~kevin/a`, nodes: []Node{newTilde("kevin"), newText("/a")}},
+		{arg: `~/*.go`, nodes: []Node{newTilde(""), newGlob("/*.go")}},
+		{arg: `~"a"`, nodes: []Node{newText("~"), newStrI([]Node{newText("a")})}},
+		{arg: `\~/a`, nodes: []Node{newText("~/a")}},
+		{arg: `"~"/a`, nodes: []Node{newStrI([]Node{newText("~")}), newText("/a")}},
+		{arg: `a~/b`, nodes: []Node{newText("a~/b")}},
+		{arg: `~a:~b`, nodes: []Node{newText("~a:~b")}},
+		{arg: `$a~`, nodes: []Node{newEnvVar("a", nil), newText("~")}},
+	} {
+		n, _, err := newParser(i.arg).parseArg(i.arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		assert.Equal(newArg(i.nodes), stripSpan(n), "tilde prefix should be parsed for %q", i.arg)
+	}
+	{
+		arg := `A=~/bin:~kevin/bin:a~:\~`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		assert.Equal([]*Assign{newAssign("A", newArg([]Node{newTilde(""), newText("/bin:"), newTilde("kevin"), newText("/bin:a~:~")}))}, stripSpan(n.Lists[0].Pipes[0].Cmds[0].Assigns), "tilde prefixes should follow ':' in assignments")
+	}
+	{
+		arg := `echo ${a:-~} $(cat ~/a)`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+		args := n.Lists[0].Pipes[0].Cmds[0].Args
+		assert.Equal(newEnvVar("a", []*Arg{newArg([]Node{newTilde("")})}), stripSpan(args[1].Nodes[0]), "tilde prefix should be parsed in variable words")
+		assert.Equal(newArg([]Node{newTilde(""), newText("/a")}), stripSpan(args[2].Nodes[0].(*CmdSub).Script.Lists[0].Pipes[0].Cmds[0].Args[1]), "tilde prefix should be parsed in command substitutions")
+	}
+}
+
+func Test_Tilde_Value(t *testing.T) {
+	assert := assert.New(t)
+
+	home := func(user string) (string, bool) {
+		switch user {
+		case "":
+			return "/home/me", true
+		case "kevin":
+			return "/home/kevin dir", true
+		default:
+			return "", false
+		}
+	}
+	ctx := context.Background()
+	for _, i := range []struct {
+		arg    string
+		env    Env
+		fields []string
+	}{
+		{arg: `~`, env: Env{Home: home}, fields: []string{"/home/me"}},
+		{arg: `~/a`, env: Env{Home: home, Vars: map[string]string{"HOME": "/root"}}, fields: []string{"/root/a"}},
+		{arg: `~kevin/*`, env: Env{Home: home, Vars: map[string]string{"HOME": "/root"}}, fields: []string{"/home/kevin dir/*"}},
+		{arg: `~bogus/a`, env: Env{Home: home}, fields: []string{"~bogus/a"}},
+		{arg: `~`, env: Env{Home: home, Vars: map[string]string{"HOME": "/a b/[c]*"}}, fields: []string{"/a b/[c]*"}},
+		{arg: `\~ "~"`, env: Env{Home: home}, fields: []string{"~"}},
+		{arg: `${a#~/}`, env: Env{Home: home, Vars: map[string]string{"a": "/home/me/x"}}, fields: []string{"x"}},
+	} {
+		n, _, err := newParser(i.arg).parseArg(i.arg, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		fields, err := n.Fields(ctx, i.env)
+		assert.NoError(err, "fields should not error")
+		assert.Equal(i.fields, fields, "tilde prefix should be expanded without splitting for %q", i.arg)
+	}
+	{
+		vars := map[string]string{}
+		n, err := Parse(`A=~/bin:~kevin/bin; B=~; C=x~`)
+		assert.NoError(err, "Parse should not error")
+		_, err = n.Exec(Env{Home: home, Vars: vars})
+		assert.NoError(err, "script should not error")
+		assert.Equal(map[string]string{"A": "/home/me/bin:/home/kevin dir/bin", "B": "/home/me", "C": "x~"}, vars, "tilde prefixes should be expanded in assignments")
+	}
+}
@@ -0,0 +1,134 @@
+package nutcracker
+
+import (
+	"strings"
+)
+
+type (
+	// Visitor visits each node of a syntax tree in Walk. If the Visitor w
+	// returned by Visit is not nil, Walk visits each child of the node with w,
+	// followed by a call of w.Visit(nil).
+	Visitor interface {
+		Visit(n Syntax) (w Visitor)
+	}
+
+	inspector func(Syntax) bool
+)
+
+// Walk traverses a syntax tree in depth first order
+func Walk(v Visitor, n Syntax) {
+	if v = v.Visit(n); v == nil {
+		return
+	}
+
+	switch k := n.(type) {
+	case *Script:
+		for _, i := range k.Lists {
+			Walk(v, i)
+		}
+	case *AndOr:
+		for _, i := range k.Pipes {
+			Walk(v, i)
+		}
+	case *Pipeline:
+		for _, i := range k.Cmds {
+			Walk(v, i)
+		}
+	case *Cmd:
+		for _, i := range k.Assigns {
+			Walk(v, i)
+		}
+		for _, i := range k.Args {
+			Walk(v, i)
+		}
+		for _, i := range k.Redirs {
+			Walk(v, i)
+		}
+	case *Assign:
+		Walk(v, k.Value)
+	case *Redirect:
+		Walk(v, k.Target)
+	case *Arg:
+		for _, i := range k.Nodes {
+			Walk(v, i)
+		}
+	case *StrI:
+		for _, i := range k.Nodes {
+			Walk(v, i)
+		}
+	case *EnvVar:
+		for _, i := range k.Default {
+			Walk(v, i)
+		}
+	case *VarAssign:
+		for _, i := range k.Word {
+			Walk(v, i)
+		}
+	case *VarCheck:
+		for _, i := range k.Word {
+			Walk(v, i)
+		}
+	case *VarAlt:
+		for _, i := range k.Word {
+			Walk(v, i)
+		}
+	case *VarTrimPrefix:
+		for _, i := range k.Pattern {
+			Walk(v, i)
+		}
+	case *VarTrimSuffix:
+		for _, i := range k.Pattern {
+			Walk(v, i)
+		}
+	case *Brace:
+		for _, i := range k.Words {
+			Walk(v, i)
+		}
+	case *Arith:
+		for _, i := range k.Nodes {
+			Walk(v, i)
+		}
+	case *CmdSub:
+		Walk(v, k.Script)
+	}
+
+	v.Visit(nil)
+}
+
+func (f inspector) Visit(n Syntax) Visitor {
+	if f(n) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a syntax tree in depth first order, calling f for each
+// node. If f returns true, Inspect visits each child of the node, followed by
+// a call of f(nil).
+func Inspect(n Syntax, f func(Syntax) bool) {
+	Walk(inspector(f), n)
+}
+
+// Literal returns the value of the argument if it contains no expansions
+func (n Arg) Literal() (string, bool) {
+	s := strings.Builder{}
+	for _, i := range n.Nodes {
+		switch k := i.(type) {
+		case *Text:
+			s.WriteString(k.Text)
+		case *StrL:
+			s.WriteString(k.Text)
+		case *StrI:
+			for _, j := range k.Nodes {
+				t, ok := j.(*Text)
+				if !ok {
+					return "", false
+				}
+				s.WriteString(t.Text)
+			}
+		default:
+			return "", false
+		}
+	}
+	return s.String(), true
+}
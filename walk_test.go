@@ -0,0 +1,135 @@
+package nutcracker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Walk(t *testing.T) {
+	assert := assert.New(t)
+
+	{
+		arg := `echo "$a ${b:-$(cat $c)}" > $d | tr a-z A-Z && rm -rf '/' || echo $e`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+
+		vars := []string{}
+		subs := 0
+		Inspect(n, func(n Syntax) bool {
+			switch k := n.(type) {
+			case *EnvVar:
+				vars = append(vars, k.Name)
+			case *CmdSub:
+				subs++
+			}
+			return true
+		})
+		assert.Equal([]string{"a", "b", "c", "d", "e"}, vars, "all variables should be visited in order")
+		assert.Equal(1, subs, "all command substitutions should be visited")
+
+		cmds := []string{}
+		Inspect(n, func(n Syntax) bool {
+			if k, ok := n.(*Cmd); ok {
+				name, ok := k.Args[0].Literal()
+				assert.True(ok, "command names should be literal")
+				cmds = append(cmds, name)
+			}
+			return true
+		})
+		assert.Equal([]string{"echo", "cat", "tr", "rm", "echo"}, cmds, "all commands should be visited in order")
+	}
+	{
+		arg := `echo $(cat $a)`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+
+		vars := []string{}
+		Inspect(n, func(n Syntax) bool {
+			switch k := n.(type) {
+			case *EnvVar:
+				vars = append(vars, k.Name)
+			case *CmdSub:
+				return false
+			}
+			return true
+		})
+		assert.Equal([]string{}, vars, "children should not be visited if f returns false")
+	}
+	{
+		arg := `echo ${a:=$b} ${c:?$d} ${e+$f} ${g#$h} ${i%%$j}`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+
+		vars := []string{}
+		Inspect(n, func(n Syntax) bool {
+			if k, ok := n.(*EnvVar); ok {
+				vars = append(vars, k.Name)
+			}
+			return true
+		})
+		assert.Equal([]string{"b", "d", "f", "h", "j"}, vars, "parameter expansion words should be visited")
+	}
+	{
+		arg := `echo {$a,{$b,c}}{1..3}`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+
+		vars := []string{}
+		Inspect(n, func(n Syntax) bool {
+			if k, ok := n.(*EnvVar); ok {
+				vars = append(vars, k.Name)
+			}
+			return true
+		})
+		assert.Equal([]string{"a", "b"}, vars, "brace expansion words should be visited")
+	}
+	{
+		arg := `echo $(( $a + $(cat $b) ))`
+		n, err := Parse(arg)
+		assert.NoError(err, "Parse should not error")
+
+		vars := []string{}
+		Inspect(n, func(n Syntax) bool {
+			if k, ok := n.(*EnvVar); ok {
+				vars = append(vars, k.Name)
+			}
+			return true
+		})
+		assert.Equal([]string{"a", "b"}, vars, "arithmetic expansion nodes should be visited")
+	}
+	{
+		n, err := Parse(`echo hello`)
+		assert.NoError(err, "Parse should not error")
+
+		nodes := []Syntax{}
+		Inspect(n, func(n Syntax) bool {
+			nodes = append(nodes, n)
+			return true
+		})
+		cmd := n.Lists[0].Pipes[0].Cmds[0]
+		assert.Equal([]Syntax{
+			n, n.Lists[0], n.Lists[0].Pipes[0], cmd,
+			cmd.Args[0], cmd.Args[0].Nodes[0], nil, nil,
+			cmd.Args[1], cmd.Args[1].Nodes[0], nil, nil,
+			nil, nil, nil, nil,
+		}, nodes, "f should be called with nil after the children of each node")
+	}
+}
+
+func Test_Arg_Literal(t *testing.T) {
+	assert := assert.New(t)
+
+	{
+		n, _, err := newParser(`a\ b'c d'"e f"`).parseArg(`a\ b'c d'"e f"`, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		v, ok := n.Literal()
+		assert.True(ok, "arg without expansions should be literal")
+		assert.Equal("a bc de f", v, "literal should have quotes removed")
+	}
+	{
+		n, _, err := newParser(`a"$b"`).parseArg(`a"$b"`, argModeNorm)
+		assert.NoError(err, "parse arg should not error")
+		_, ok := n.Literal()
+		assert.False(ok, "arg with expansions should not be literal")
+	}
+}